@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var cookedAnchorPattern = regexp.MustCompile(`<h[1-6][^>]*>\s*<a name="([^"]+)" class="anchor"`)
+
+// headingAnchors returns the anchor names Discourse generated for the
+// headings of post, in order.
+func headingAnchors(post *Post) []string {
+	var anchors []string
+	for _, m := range cookedAnchorPattern.FindAllStringSubmatch(post.Cooked, -1) {
+		anchors = append(anchors, m[1])
+	}
+	return anchors
+}
+
+var slugInvalidPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify approximates the slug Discourse derives from heading text.
+func slugify(text string) string {
+	return strings.Trim(slugInvalidPattern.ReplaceAllString(strings.ToLower(text), "-"), "-")
+}
+
+// changedAnchors returns the anchors of headings in the post content
+// that are changed or removed in text.
+func changedAnchors(post *Post, text string) []string {
+	kept := make(map[string]bool)
+	for _, h := range parseHeadings(text) {
+		kept[slugify(h.Text)] = true
+	}
+	anchors := headingAnchors(post)
+	headings := parseHeadings(post.Raw)
+	var changed []string
+	for i, h := range headings {
+		if kept[slugify(h.Text)] {
+			continue
+		}
+		// The cooked content only lines up with the raw headings
+		// when both agree on how many there are.
+		if len(anchors) == len(headings) {
+			changed = append(changed, anchors[i])
+		} else if slug := slugify(h.Text); slug != "" {
+			changed = append(changed, slug)
+		}
+	}
+	return changed
+}
+
+var topicLinkPattern = regexp.MustCompile(`/t/([^/\s()#?]+)(?:/([0-9]+))?(?:/[0-9]+)?(?:#([A-Za-z0-9_-]+))?`)
+
+// linkedTopic returns the topic ID and anchor, if any, in a topicLinkPattern match.
+// Links may be in the /t/<slug>/<id>/<post> or /t/<id>/<post> forms.
+func linkedTopic(m []string) (topicID, anchor string) {
+	if _, err := strconv.Atoi(m[1]); err == nil {
+		return m[1], m[3]
+	}
+	return m[2], m[3]
+}
+
+// anchorLinks returns the mirrored topics in the forum mirrors that
+// link to the given anchors of topic, keyed by anchor.
+func (f *Forum) anchorLinks(topic *Topic, anchors []string) (map[string][]*MirrorTopic, error) {
+	wanted := make(map[string]bool)
+	for _, anchor := range anchors {
+		wanted[anchor] = true
+	}
+	links := make(map[string][]*MirrorTopic)
+	for _, dir := range f.config.Mirrors {
+		mirror, err := readMirror(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, mt := range mirror.Topics {
+			if mt.TopicID == topic.ID {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(dir, mt.File))
+			if err != nil {
+				continue
+			}
+			seen := make(map[string]bool)
+			for _, m := range topicLinkPattern.FindAllStringSubmatch(string(data), -1) {
+				id, anchor := linkedTopic(m)
+				if id == strconv.Itoa(topic.ID) && wanted[anchor] && !seen[anchor] {
+					seen[anchor] = true
+					links[anchor] = append(links[anchor], mt)
+				}
+			}
+		}
+	}
+	return links, nil
+}
+
+// warnChangedAnchors warns about headings of topic.Post that are changed
+// or removed in text, as that breaks links to their anchors, and lists
+// the topics in the configured mirrors that link to them.
+func warnChangedAnchors(forum *Forum, topic *Topic, text string) error {
+	anchors := changedAnchors(topic.Post, text)
+	if len(anchors) == 0 {
+		return nil
+	}
+	links, err := forum.anchorLinks(topic, anchors)
+	if err != nil {
+		return fmt.Errorf("cannot look for links to changed headings: %v", err)
+	}
+	for _, anchor := range anchors {
+		logf("WARNING: Heading anchor #%s is changed or removed.", anchor)
+		for _, mt := range links[anchor] {
+			logf("WARNING:   Linked from %q (%s)", mt.Title, mt.File)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Archive holds everything needed to back up or migrate a topic.
+type Archive struct {
+	Forum      string            `json:"forum"`
+	URL        string            `json:"url"`
+	ArchivedAt time.Time         `json:"archived_at"`
+	Topic      json.RawMessage   `json:"topic"`
+	Posts      []*ArchivedPost   `json:"posts"`
+	Uploads    []*ArchivedUpload `json:"uploads"`
+}
+
+type ArchivedPost struct {
+	ID         int       `json:"id"`
+	PostNumber int       `json:"post_number"`
+	Username   string    `json:"username"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Raw        string    `json:"raw"`
+
+	// Revisions holds the revision data as provided by the forum,
+	// from the second version of the post onwards.
+	Revisions []json.RawMessage `json:"revisions,omitempty"`
+}
+
+type ArchivedUpload struct {
+	URL         string `json:"url"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+func runArchive(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("archive command expects a single topic URL")
+	}
+	forum, topicID, err := openTopic(config, args[0])
+	if err != nil {
+		return err
+	}
+	stats.Phase("load")
+	topic, err := forum.LoadTopic(topicID)
+	if err != nil {
+		return err
+	}
+	err = forum.LoadAllPosts(topic)
+	if err != nil {
+		return err
+	}
+	stats.Phase("archive")
+	archive, err := forum.ArchiveTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	filename := *outputPath
+	if filename == "" {
+		filename = fmt.Sprintf("%s-%d.json", topic.Slug, topic.ID)
+	}
+	return writeOutput(filename, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(archive)
+	})
+}
+
+// ArchiveTopic collects the topic metadata, all of its posts with their
+// revisions, and the uploads referenced by them.
+func (f *Forum) ArchiveTopic(topic *Topic) (*Archive, error) {
+	archive := &Archive{
+		Forum:      f.baseURL,
+		URL:        topic.ForumURL(f),
+		ArchivedAt: time.Now().UTC(),
+		Topic:      json.RawMessage(topic.content),
+	}
+
+	seen := make(map[string]bool)
+	for _, post := range topic.Posts {
+		apost := &ArchivedPost{
+			ID:         post.ID,
+			PostNumber: post.PostNumber,
+			Username:   post.Username,
+			CreatedAt:  post.CreatedAt,
+			UpdatedAt:  post.UpdatedAt,
+			Raw:        post.Raw,
+		}
+		for version := 2; version <= post.Version; version++ {
+			revision, err := f.LoadRevision(post, version)
+			if err != nil {
+				return nil, err
+			}
+			apost.Revisions = append(apost.Revisions, revision)
+		}
+		archive.Posts = append(archive.Posts, apost)
+
+		for _, uploadURL := range uploadURLs(f, post.Cooked) {
+			if seen[uploadURL] {
+				continue
+			}
+			seen[uploadURL] = true
+
+			logf("Downloading %s ...", uploadURL)
+			data, contentType, err := f.download(uploadURL)
+			if err != nil {
+				return nil, err
+			}
+			archive.Uploads = append(archive.Uploads, &ArchivedUpload{
+				URL:         uploadURL,
+				Filename:    path.Base(uploadURL),
+				ContentType: contentType,
+				Data:        data,
+			})
+		}
+	}
+	return archive, nil
+}
+
+// LoadRevision returns the data for the given revision of post.
+func (f *Forum) LoadRevision(post *Post, version int) (json.RawMessage, error) {
+
+	logf("Loading revision %d of post %d...", version, post.ID)
+
+	var result json.RawMessage
+	err := f.do("GET", "/posts/"+strconv.Itoa(post.ID)+"/revisions/"+strconv.Itoa(version)+".json", nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+var uploadPattern = regexp.MustCompile(`(?:src|href)="([^"]*/uploads/[^"]+)"`)
+
+// uploadURLs returns the absolute URLs of all uploads referenced
+// in the cooked content of a post.
+func uploadURLs(forum *Forum, cooked string) []string {
+	var urls []string
+	for _, m := range uploadPattern.FindAllStringSubmatch(cooked, -1) {
+		urls = append(urls, forum.absoluteURL(strings.Replace(m[1], "&amp;", "&", -1)))
+	}
+	return urls
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+)
+
+// CurrentUsername returns the username discedit acts as in the forum.
+func (f *Forum) CurrentUsername() (string, error) {
+	if f.config.Username != "" {
+		return f.config.Username, nil
+	}
+	if f.username != "" {
+		return f.username, nil
+	}
+	var result struct {
+		CurrentUser struct {
+			Username string `json:"username"`
+		} `json:"current_user"`
+	}
+	err := f.do("GET", "/session/current.json", nil, &result)
+	if err != nil {
+		return "", fmt.Errorf("cannot find out current user: %v", err)
+	}
+	if result.CurrentUser.Username == "" {
+		return "", fmt.Errorf("cannot find out current user: forum did not report it")
+	}
+	f.username = result.CurrentUser.Username
+	return f.username, nil
+}
+
+// AssignTopic assigns the topic to the current user via the assign plugin,
+// so others can see it is being worked on. The returned function undoes
+// the assignment, unless the topic was already assigned to the user.
+func (f *Forum) AssignTopic(topic *Topic) (unassign func(), err error) {
+	username, err := f.CurrentUsername()
+	if err != nil {
+		return nil, err
+	}
+	if topic.AssignedTo != nil {
+		if topic.AssignedTo.Username == username {
+			return func() {}, nil
+		}
+		logf("WARNING: Topic %s is assigned to %s.", topic, topic.AssignedTo.Username)
+		return func() {}, nil
+	}
+	if *dryRun {
+		logf("Dry run: not assigning %s to %s.", topic, username)
+		return func() {}, nil
+	}
+
+	logf("Assigning %s to %s...", topic, username)
+
+	body := map[string]interface{}{
+		"target_id":   topic.ID,
+		"target_type": "Topic",
+		"username":    username,
+	}
+	err = f.do("PUT", "/assign/assign", body, nil)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("cannot assign topic: forum %s does not seem to run the assign plugin", f.baseURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot assign topic: %v", err)
+	}
+	topic.AssignedTo = &TopicUser{Username: username}
+
+	return func() {
+		logf("Unassigning %s...", topic)
+		body := map[string]interface{}{
+			"target_id":   topic.ID,
+			"target_type": "Topic",
+		}
+		err := f.do("PUT", "/assign/unassign", body, nil)
+		if err != nil {
+			logf("WARNING: Cannot unassign %s: %v", topic, err)
+			return
+		}
+		topic.AssignedTo = nil
+	}, nil
+}
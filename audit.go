@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// auditCommands holds the subcommands of the audit command.
+var auditCommands = map[string]command{
+	"crosslinks": runAuditCrosslinks,
+	"headings":   runAuditHeadings,
+	"images":     runAuditImages,
+	"linkmap":    runAuditLinkMap,
+}
+
+func runAudit(config *Config, args []string) error {
+	if len(args) == 0 || auditCommands[args[0]] == nil {
+		var names []string
+		for name := range auditCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("audit command expects one of: %s", strings.Join(names, ", "))
+	}
+	return auditCommands[args[0]](config, subcommandArgs(args[1:]))
+}
+
+func runAuditHeadings(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("audit headings command expects a single topic URL")
+	}
+	forum, topicID, err := openTopic(config, args[0])
+	if err != nil {
+		return err
+	}
+	topic, err := forum.LoadTopic(topicID)
+	if err != nil {
+		return err
+	}
+	problems := auditHeadings(topic.Title, topic.Post.Raw)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d heading problem(s) in %s", len(problems), topic)
+	}
+	logf("No heading problems in %s.", topic)
+	return nil
+}
+
+// Heading is a markdown heading found in a text.
+type Heading struct {
+	Line  int
+	Level int
+	Text  string
+}
+
+var headingPattern = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+
+// parseHeadings returns the ATX headings in text, ignoring anything
+// inside fenced code blocks.
+func parseHeadings(text string) []Heading {
+	var headings []Heading
+	var fence string
+	for i, line := range strings.Split(text, "\n") {
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if strings.HasPrefix(m[1], fence) && strings.TrimSpace(line) == m[1] {
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			headings = append(headings, Heading{Line: i + 1, Level: len(m[1]), Text: strings.TrimSpace(m[2])})
+		}
+	}
+	return headings
+}
+
+// auditHeadings returns a description of each problem found in the
+// heading structure of text: skipped heading levels, duplicate
+// headings, and top-level headings that compete with the topic title.
+func auditHeadings(title, text string) []string {
+	var problems []string
+	seen := make(map[string]int)
+	previous := 1
+	for _, h := range parseHeadings(text) {
+		if h.Level == 1 {
+			if strings.EqualFold(h.Text, strings.TrimSpace(title)) {
+				problems = append(problems, fmt.Sprintf("line %d: heading %q repeats the topic title", h.Line, h.Text))
+			} else {
+				problems = append(problems, fmt.Sprintf("line %d: top-level heading %q competes with the topic title", h.Line, h.Text))
+			}
+		}
+		if h.Level > previous+1 {
+			problems = append(problems, fmt.Sprintf("line %d: heading %q skips from level %d to %d", h.Line, h.Text, previous, h.Level))
+		}
+		previous = h.Level
+		key := strings.ToLower(h.Text)
+		if line, ok := seen[key]; ok {
+			problems = append(problems, fmt.Sprintf("line %d: heading %q duplicates the one at line %d", h.Line, h.Text, line))
+		} else {
+			seen[key] = h.Line
+		}
+	}
+	return problems
+}
+
+// LinkMapTopic holds the outbound links of a topic.
+type LinkMapTopic struct {
+	TopicID int       `json:"topic"`
+	Title   string    `json:"title"`
+	URL     string    `json:"url"`
+	Links   []LinkRef `json:"links"`
+}
+
+// LinkRef is a link found in the content of a topic. TopicID is set
+// when the link targets a topic in the same forum.
+type LinkRef struct {
+	URL     string `json:"url"`
+	TopicID int    `json:"topic,omitempty"`
+	Anchor  string `json:"anchor,omitempty"`
+}
+
+func runAuditLinkMap(config *Config, args []string) error {
+	forum, categoryPath, err := openCategory(config, args)
+	if err != nil {
+		return err
+	}
+	topics, err := forum.LoadCategoryTopics(categoryPath)
+	if err != nil {
+		return err
+	}
+
+	var linkMap []*LinkMapTopic
+	progress := newProgress(len(topics))
+	for _, topic := range topics {
+		progress.Start(topic.Title)
+		raw, err := forum.LoadRaw(topic.ID, 1)
+		if err != nil {
+			progress.Failed(err)
+			continue
+		}
+		linkMap = append(linkMap, &LinkMapTopic{
+			TopicID: topic.ID,
+			Title:   topic.Title,
+			URL:     topic.ForumURL(forum),
+			Links:   forum.outboundLinks(raw),
+		})
+		progress.Succeeded()
+	}
+	summaryErr := progress.Summary()
+
+	filename := *outputPath
+	if filename == "" {
+		filename = "-"
+	}
+	err = writeOutput(filename, func(w io.Writer) error {
+		if *jsonOutput {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "\t")
+			return encoder.Encode(linkMap)
+		}
+		for _, lt := range linkMap {
+			fmt.Fprintf(w, "%s (%s)\n", lt.Title, lt.URL)
+			for _, link := range lt.Links {
+				fmt.Fprintf(w, "\t%s\n", link.URL)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return summaryErr
+}
+
+var (
+	markdownLinkPattern = regexp.MustCompile(`\]\(\s*<?([^)\s>]+)`)
+	bareLinkPattern     = regexp.MustCompile(`https?://[^\s()<>\[\]"']+[^\s()<>\[\]"'.,;:!?]`)
+)
+
+// outboundLinks returns the distinct links in the raw content, in the
+// order they first appear. Links to topics in the forum are identified.
+func (f *Forum) outboundLinks(raw string) []LinkRef {
+	var links []LinkRef
+	seen := make(map[string]bool)
+	add := func(url string) {
+		if seen[url] {
+			return
+		}
+		seen[url] = true
+		link := LinkRef{URL: url}
+		if strings.HasPrefix(url, "/") || strings.HasPrefix(url, f.baseURL+"/") {
+			if m := topicLinkPattern.FindStringSubmatch(url); m != nil {
+				id, anchor := linkedTopic(m)
+				link.TopicID, _ = strconv.Atoi(id)
+				link.Anchor = anchor
+			}
+		}
+		links = append(links, link)
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		for _, m := range markdownLinkPattern.FindAllStringSubmatch(line, -1) {
+			add(m[1])
+		}
+		for _, url := range bareLinkPattern.FindAllString(line, -1) {
+			add(url)
+		}
+	}
+	return links
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// The cache holds information obtained from forums that rarely
+// changes, such as their Discourse version, so that it doesn't
+// have to be requested again on every run.
+
+type cacheEntry struct {
+	Time  time.Time       `json:"time"`
+	Value json.RawMessage `json:"value"`
+}
+
+func cachePath() string {
+	return configPath + ".cache"
+}
+
+func readCache() (map[string]*cacheEntry, error) {
+	entries := make(map[string]*cacheEntry)
+	data, err := ioutil.ReadFile(cachePath())
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read cache: %v", err)
+	}
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode cache %s: %v", cachePath(), err)
+	}
+	return entries, nil
+}
+
+// cacheGet decodes the value cached under key into value, and reports
+// whether it was found and is not older than maxAge.
+func cacheGet(key string, maxAge time.Duration, value interface{}) bool {
+	unlock, err := lockPath(cachePath())
+	if err != nil {
+		debugf("Cannot lock cache: %v", err)
+		return false
+	}
+	entries, err := readCache()
+	unlock()
+	if err != nil {
+		debugf("%v", err)
+		return false
+	}
+	entry := entries[key]
+	if entry == nil || time.Since(entry.Time) > maxAge {
+		return false
+	}
+	err = json.Unmarshal(entry.Value, value)
+	if err != nil {
+		debugf("Cannot decode cached %s: %v", key, err)
+		return false
+	}
+	return true
+}
+
+// cacheSet stores value in the cache under key.
+func cacheSet(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("internal error: cannot marshal cache value: %v", err)
+	}
+	unlock, err := lockPath(cachePath())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := readCache()
+	if err != nil {
+		return err
+	}
+	entries[key] = &cacheEntry{Time: time.Now(), Value: data}
+	data, err = json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return fmt.Errorf("internal error: cannot marshal cache: %v", err)
+	}
+	err = ioutil.WriteFile(cachePath(), data, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write cache: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runCategory runs the category subcommands.
+func runCategory(config *Config, args []string) error {
+	if len(args) > 0 && (args[0] == "snapshot" || args[0] == "restore") {
+		action := args[0]
+		args = subcommandArgs(args[1:])
+		if len(args) != 2 {
+			return fmt.Errorf("category %s expects a category URL and a directory", action)
+		}
+		forum, categoryPath, err := openCategory(config, args[:1])
+		if err != nil {
+			return err
+		}
+		if action == "snapshot" {
+			return snapshotCategory(forum, categoryPath, args[1])
+		}
+		return restoreCategory(forum, categoryPath, args[1])
+	}
+	if len(args) == 0 || args[0] != "create" {
+		return fmt.Errorf("category command expects create, snapshot, or restore")
+	}
+	args = subcommandArgs(args[1:])
+	if len(args) != 1 {
+		return fmt.Errorf("category create expects a single forum URL")
+	}
+	if *categoryName == "" {
+		return fmt.Errorf("category create requires the -name option")
+	}
+	baseURL, err := parseForumURL(config.expandAlias(args[0]))
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, baseURL)
+	if err != nil {
+		return err
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+	site, err := forum.Site()
+	if err != nil {
+		return fmt.Errorf("cannot list categories: %v", err)
+	}
+
+	var parent *SiteCategory
+	var parentID int
+	if *parentCategory != "" {
+		parent = site.CategoryByPath(*parentCategory)
+		if parent == nil {
+			return fmt.Errorf("category %s does not exist or is not visible to the configured user", *parentCategory)
+		}
+		parentID = parent.ID
+	}
+
+	// Creating a category that exists already succeeds, so that
+	// provisioning scripts may be run again.
+	for _, c := range site.Categories {
+		if c.Name == *categoryName && c.ParentCategoryID == parentID {
+			logf("Category %q exists already.", c.Name)
+			fmt.Println(forum.categoryURL(site, c))
+			return nil
+		}
+	}
+
+	created, err := forum.CreateCategory(*categoryName, parent)
+	if err != nil || created == nil {
+		return err
+	}
+	site.Categories = append(site.Categories, created)
+	fmt.Println(forum.categoryURL(site, created))
+	return nil
+}
+
+// CreateCategory creates a category with the given name, as a
+// subcategory of parent unless it is nil. In dry-run mode nothing
+// is created and the returned category is nil.
+func (f *Forum) CreateCategory(name string, parent *SiteCategory) (*SiteCategory, error) {
+	if *dryRun {
+		logf("Dry run: not creating category %q.", name)
+		return nil, nil
+	}
+
+	logf("Creating category %q...", name)
+
+	body := map[string]interface{}{
+		"name":       name,
+		"color":      "0088CC",
+		"text_color": "FFFFFF",
+	}
+	if parent != nil {
+		body["parent_category_id"] = parent.ID
+	}
+	var result struct {
+		Category *SiteCategory `json:"category"`
+	}
+	err := f.do("POST", "/categories.json", body, &result)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create category: %v", err)
+	}
+	if result.Category == nil {
+		return nil, fmt.Errorf("internal error: creating category %q returned no category data", name)
+	}
+	logf("Created category %q.", name)
+	return result.Category, nil
+}
+
+// categoryURL returns the URL of the category c.
+func (f *Forum) categoryURL(site *Site, c *SiteCategory) string {
+	path := c.Slug + "/" + strconv.Itoa(c.ID)
+	if parent := site.Category(c.ParentCategoryID); parent != nil {
+		path = parent.Slug + "/" + path
+	}
+	return f.baseURL + "/c/" + path
+}
+
+// snapshotCategory writes an archive of every topic in the category at
+// categoryPath into dir, holding the topic metadata, its first post, and
+// the uploads that post references. Subcategories are included with
+// -recurse, in nested directories named after their slugs as done when
+// mirroring. See restoreCategory.
+func snapshotCategory(forum *Forum, categoryPath, dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create snapshot directory: %v", err)
+	}
+
+	stats.Phase("list")
+	var topics []*Topic
+	var subdirs map[int]string
+	if *recurse {
+		topics, subdirs, err = loadCategoryTree(forum, categoryPath)
+	} else {
+		topics, err = forum.LoadCategoryTopics(categoryPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	stats.Phase("snapshot")
+	progress := newProgress(len(topics))
+	for _, listed := range topics {
+		progress.Start(listed.Title)
+		topic, err := forum.LoadTopic(listed.ID)
+		if err != nil {
+			progress.Failed(err)
+			continue
+		}
+		topic.Posts = []*Post{topic.Post}
+		archive, err := forum.ArchiveTopic(topic)
+		if err != nil {
+			progress.Failed(err)
+			continue
+		}
+		filename := filepath.Join(dir, filepath.FromSlash(subdirs[listed.Category]), fmt.Sprintf("%s-%d.json", topic.Slug, topic.ID))
+		err = os.MkdirAll(filepath.Dir(filename), 0755)
+		if err == nil {
+			err = writeOutput(filename, func(w io.Writer) error {
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "\t")
+				return encoder.Encode(archive)
+			})
+		}
+		if err != nil {
+			progress.Failed(err)
+			continue
+		}
+		progress.Succeeded()
+	}
+	return progress.Summary()
+}
+
+// restoreCategory recreates or updates the topics archived in dir by
+// snapshotCategory within the category at categoryPath, and those in
+// nested directories within the matching subcategories. Topics that
+// still exist in the same forum are updated in place, as are topics in
+// the category with the same title or slug, such as when restoring into
+// another forum more than once. All others are created anew along with
+// their uploads.
+func restoreCategory(forum *Forum, categoryPath, dir string) error {
+	err := forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+	site, err := forum.Site()
+	if err != nil {
+		return fmt.Errorf("cannot find category: %v", err)
+	}
+	c := site.CategoryByPath(categoryPath)
+	if c == nil {
+		return fmt.Errorf("category %s does not exist or is not visible to the configured user", categoryPath)
+	}
+	var filenames []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(path, ".json") {
+			filenames = append(filenames, path)
+		}
+		return err
+	})
+	if err != nil || len(filenames) == 0 {
+		return fmt.Errorf("no archived topics found in %s", dir)
+	}
+
+	// Topics already in each target category, listed once it's needed.
+	existing := make(map[int][]*Topic)
+
+	stats.Phase("restore")
+	progress := newProgress(len(filenames))
+	for _, filename := range filenames {
+		rel, _ := filepath.Rel(dir, filename)
+		progress.Start(filepath.ToSlash(rel))
+		target := c
+		if subdir := filepath.ToSlash(filepath.Dir(rel)); subdir != "." {
+			target = site.CategoryByPath(categoryPath + "/" + subdir)
+			if target == nil {
+				progress.Failed(fmt.Errorf("category %s/%s does not exist or is not visible to the configured user", categoryPath, subdir))
+				continue
+			}
+		}
+		topics, ok := existing[target.ID]
+		if !ok {
+			topics, err = forum.categoryTopics(categoryPath, c, target)
+			if err != nil {
+				progress.Failed(err)
+				continue
+			}
+			existing[target.ID] = topics
+		}
+		updated, err := forum.restoreTopic(filename, target.ID, topics)
+		switch {
+		case err != nil:
+			progress.Failed(err)
+		case updated:
+			progress.Succeeded()
+		default:
+			progress.Skipped("unchanged")
+		}
+	}
+	return progress.Summary()
+}
+
+// categoryTopics returns the topics in the target category, which is
+// either root at categoryPath or one of its subcategories. Listings
+// include the topics of subcategories, so those are left out.
+func (f *Forum) categoryTopics(categoryPath string, root, target *SiteCategory) ([]*Topic, error) {
+	if target.ID != root.ID {
+		categoryPath = fmt.Sprintf("%s/%d", target.Slug, target.ID)
+	}
+	listed, err := f.LoadCategoryTopics(categoryPath)
+	if err != nil {
+		return nil, err
+	}
+	var topics []*Topic
+	for _, topic := range listed {
+		if topic.Category == target.ID {
+			topics = append(topics, topic)
+		}
+	}
+	return topics, nil
+}
+
+// restoreTopic restores the topic archived in filename into the category
+// with categoryID, holding the existing topics provided, and reports
+// whether anything had to be changed for that.
+func (f *Forum) restoreTopic(filename string, categoryID int, existing []*Topic) (updated bool, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false, fmt.Errorf("cannot read archive: %v", err)
+	}
+	var archive Archive
+	var archived Topic
+	err = json.Unmarshal(data, &archive)
+	if err == nil {
+		err = json.Unmarshal(archive.Topic, &archived)
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot decode archive: %v", err)
+	}
+	var raw string
+	for _, post := range archive.Posts {
+		if post.PostNumber == 1 {
+			raw = post.Raw
+		}
+	}
+	if raw == "" {
+		return false, fmt.Errorf("archive has no first post")
+	}
+
+	if archive.Forum == f.baseURL {
+		topic, err := f.LoadTopic(archived.ID)
+		if err == nil {
+			return f.restoreExisting(topic, &archived, raw)
+		}
+		if !isNotFound(err) {
+			return false, err
+		}
+		logf("Topic %d is gone, so it will be created again.", archived.ID)
+	}
+	if match := matchTopic(existing, &archived); match != nil {
+		topic, err := f.LoadTopic(match.ID)
+		if err != nil {
+			return false, err
+		}
+		return f.restoreExisting(topic, &archived, raw)
+	}
+
+	// Uploads keep their short URLs across forums, as those are derived
+	// from the file content, so uploading them again is enough for the
+	// restored content to show them.
+	if len(archive.Uploads) > 0 {
+		err = f.restoreUploads(archive.Uploads)
+		if err != nil {
+			return false, err
+		}
+	}
+	if *dryRun {
+		logf("Dry run: not creating topic %q.", archived.Title)
+		return true, nil
+	}
+	logf("Creating topic %q...", archived.Title)
+	params := map[string]interface{}{
+		"title":    archived.Title,
+		"raw":      raw,
+		"category": categoryID,
+	}
+	if len(archived.Tags) > 0 {
+		params["tags"] = []string(archived.Tags)
+	}
+	post, err := f.CreatePost(params)
+	if err != nil {
+		return false, fmt.Errorf("cannot create topic: %v", err)
+	}
+	topic := &Topic{ID: post.TopicID, Slug: post.TopicSlug, Title: archived.Title, Post: post}
+	if err := runOnPublish(f, topic, "", raw); err != nil {
+		logf("WARNING: %v", err)
+	}
+	return true, nil
+}
+
+// matchTopic returns the topic among those provided that the archived
+// one should be restored into, which is the one with the same title,
+// or otherwise the one with the same slug, or nil if there is none.
+func matchTopic(topics []*Topic, archived *Topic) *Topic {
+	for _, topic := range topics {
+		if topic.Title == archived.Title {
+			return topic
+		}
+	}
+	for _, topic := range topics {
+		if topic.Slug == archived.Slug {
+			return topic
+		}
+	}
+	return nil
+}
+
+// restoreExisting updates the title, tags, and first post of topic to
+// match those archived.
+func (f *Forum) restoreExisting(topic, archived *Topic, raw string) (updated bool, err error) {
+	if archived.Title != topic.Title {
+		if *dryRun {
+			logf("Dry run: not changing title of %s to %q.", topic, archived.Title)
+		} else {
+			logf("Changing title of %s to %q...", topic, archived.Title)
+			err = f.do("PUT", "/t/-/"+strconv.Itoa(topic.ID)+".json", map[string]interface{}{"title": archived.Title}, nil)
+			if err != nil {
+				return false, fmt.Errorf("cannot change title: %v", err)
+			}
+		}
+		updated = true
+	}
+	if strings.Join(archived.Tags, ",") != strings.Join(topic.Tags, ",") {
+		err = f.SetTags(topic, archived.Tags)
+		if err != nil {
+			return false, err
+		}
+		updated = true
+	}
+	if !sameText(raw, topic.Post.Raw) {
+		oldText := topic.Post.Raw
+		topic.Post, err = f.SavePost(topic.Post, raw, oldText)
+		if err != nil {
+			return false, err
+		}
+		if err := runOnPublish(f, topic, oldText, topic.Post.Raw); err != nil {
+			logf("WARNING: %v", err)
+		}
+		updated = true
+	}
+	return updated, nil
+}
+
+// restoreUploads uploads the archived files to the forum.
+func (f *Forum) restoreUploads(uploads []*ArchivedUpload) error {
+	dir, err := ioutil.TempDir("", "discedit-uploads-")
+	if err != nil {
+		return fmt.Errorf("cannot restore uploads: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, upload := range uploads {
+		filename := filepath.Join(dir, filepath.Base(upload.Filename))
+		err := ioutil.WriteFile(filename, upload.Data, 0600)
+		if err != nil {
+			return fmt.Errorf("cannot restore uploads: %v", err)
+		}
+		_, err = f.Upload(filename)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// defaultChangelogTemplate is used for changelog replies unless the
+// forum configuration sets its own changelog_template.
+const defaultChangelogTemplate = `Updated [post #{{.PostNumber}}]({{.URL}}): {{.Added}} lines added, {{.Removed}} removed.
+{{- if .Reason}}
+
+Reason: {{.Reason}}
+{{- end}}`
+
+// ChangelogData is available to changelog templates.
+type ChangelogData struct {
+	PostNumber int
+	URL        string
+	Added      int
+	Removed    int
+	Reason     string
+}
+
+// postChangelog replies to the topic with a short summary of the
+// changes made to topic.Post, as requested with -changelog.
+func postChangelog(forum *Forum, topic *Topic, oldText, newText string) error {
+	text := forum.config.ChangelogTemplate
+	if text == "" {
+		text = defaultChangelogTemplate
+	}
+	tmpl, err := template.New("changelog").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid changelog template: %v", err)
+	}
+	data := &ChangelogData{
+		PostNumber: topic.Post.PostNumber,
+		URL:        topic.PostURL(forum),
+		Reason:     editReasonFor(oldText, newText),
+	}
+	data.Added, data.Removed = diffStat(oldText, newText)
+	var buf strings.Builder
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return fmt.Errorf("cannot prepare changelog reply: %v", err)
+	}
+	raw := strings.TrimSpace(buf.String())
+
+	if *dryRun {
+		logf("Dry run: not posting changelog reply to %s:\n%s", topic, raw)
+		return nil
+	}
+	err = waitReply(topic)
+	if err != nil {
+		return fmt.Errorf("cannot post changelog reply: %v", err)
+	}
+	_, err = forum.CreatePost(map[string]interface{}{
+		"topic_id":             topic.ID,
+		"reply_to_post_number": topic.Post.PostNumber,
+		"raw":                  raw,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot post changelog reply: %v", err)
+	}
+	logf("Posted changelog reply to %s.", topic)
+	return nil
+}
+
+// editReasonFor returns the reason to record for the change from
+// oldText to newText: the one provided with -edit-reason, or with
+// -auto-edit-reason one generated from the changes themselves.
+func editReasonFor(oldText, newText string) string {
+	if *editReason != "" || !*autoEditReason {
+		return *editReason
+	}
+	return autoEditReasonFor(oldText, newText)
+}
+
+// autoEditReasonFor describes the change from oldText to newText in
+// terms of the sections that were changed and the links that were
+// added, removed, or updated, such as "Updated 'Install' section;
+// updated 2 links".
+func autoEditReasonFor(oldText, newText string) string {
+	oldLines, newLines := splitLines(oldText), splitLines(newText)
+	oldHeadings := make(map[int]string)
+	for _, h := range parseHeadings(oldText) {
+		oldHeadings[h.Line] = h.Text
+	}
+	newHeadings := make(map[int]string)
+	for _, h := range parseHeadings(newText) {
+		newHeadings[h.Line] = h.Text
+	}
+
+	// Follow the edit script, keeping track of the section each line
+	// falls under, and take note of the sections with changes.
+	var sections []string
+	var section string
+	changed := make(map[string]bool)
+	oldLine, newLine := 0, 0
+	for _, e := range diffLines(oldLines, newLines) {
+		if e.Op != '+' {
+			oldLine++
+			if h, ok := oldHeadings[oldLine]; ok {
+				section = h
+			}
+		}
+		if e.Op != '-' {
+			newLine++
+			if h, ok := newHeadings[newLine]; ok {
+				section = h
+			}
+		}
+		if e.Op != ' ' && !changed[section] {
+			changed[section] = true
+			sections = append(sections, section)
+		}
+	}
+
+	var parts []string
+	switch {
+	case len(sections) == 0:
+	case len(sections) > 3:
+		parts = append(parts, fmt.Sprintf("Updated %d sections", len(sections)))
+	case len(sections) == 1 && sections[0] == "":
+		parts = append(parts, "Updated introduction")
+	default:
+		var names []string
+		for _, s := range sections {
+			if s == "" {
+				names = append(names, "introduction")
+			} else {
+				names = append(names, "'"+s+"'")
+			}
+		}
+		desc := names[len(names)-1] + " section"
+		if len(names) > 1 {
+			desc = strings.Join(names[:len(names)-1], ", ") + " and " + desc + "s"
+		}
+		parts = append(parts, "Updated "+desc)
+	}
+
+	oldLinks, newLinks := linkSet(oldText), linkSet(newText)
+	var added, removed int
+	for link := range newLinks {
+		if !oldLinks[link] {
+			added++
+		}
+	}
+	for link := range oldLinks {
+		if !newLinks[link] {
+			removed++
+		}
+	}
+	switch {
+	case added > 0 && added == removed:
+		parts = append(parts, countOf(added, "updated", "link"))
+	case added > 0 && removed > 0:
+		parts = append(parts, countOf(added, "added", "link")+", "+countOf(removed, "removed", "link"))
+	case added > 0:
+		parts = append(parts, countOf(added, "added", "link"))
+	case removed > 0:
+		parts = append(parts, countOf(removed, "removed", "link"))
+	}
+
+	if len(parts) == 0 {
+		return "Minor edits"
+	}
+	reason := strings.Join(parts, "; ")
+	return strings.ToUpper(reason[:1]) + reason[1:]
+}
+
+// countOf returns a description such as "updated 3 links".
+func countOf(n int, verb, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%s 1 %s", verb, noun)
+	}
+	return fmt.Sprintf("%s %d %ss", verb, n, noun)
+}
+
+// linkSet returns the set of links in text.
+func linkSet(text string) map[string]bool {
+	links := make(map[string]bool)
+	for _, m := range markdownLinkPattern.FindAllStringSubmatch(text, -1) {
+		links[m[1]] = true
+	}
+	for _, url := range bareLinkPattern.FindAllString(text, -1) {
+		links[url] = true
+	}
+	return links
+}
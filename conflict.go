@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// conflictPolicies holds the known policies for saving content that
+// someone else changed in the forum meanwhile:
+//
+//	ask     prompt for one of the other policies
+//	merge   merge non-overlapping changes, and abort otherwise
+//	resolve merge changes, asking how to resolve overlapping ones
+//	ours    overwrite the changes made in the forum
+//	theirs  keep the changes made in the forum, dropping local ones
+//	abort   fail the save
+//
+// The policy is set with -conflict, or with the conflict setting of the
+// forum. By default it is ask when running in a terminal, and merge
+// otherwise.
+var conflictPolicies = map[string]bool{
+	"ask":     true,
+	"merge":   true,
+	"resolve": true,
+	"ours":    true,
+	"theirs":  true,
+	"abort":   true,
+}
+
+// conflictPolicy returns the policy for conflicts in the forum.
+func (f *Forum) conflictPolicy() string {
+	switch {
+	case *conflict != "":
+		return *conflict
+	case f.config.Conflict != "":
+		return f.config.Conflict
+	case isTerminal(os.Stdin):
+		return "ask"
+	}
+	return "merge"
+}
+
+// resolveConflict handles the conflict found when saving raw over rawOld
+// according to the conflict policy of the forum. When changes are merged
+// the merged content is saved, once. While live editing only the abort
+// policy applies, as the content in the editor cannot follow any changes.
+func (f *Forum) resolveConflict(post *Post, raw, rawOld string, conflict error) (saved *Post, pending bool, err error) {
+	policy := f.conflictPolicy()
+	if policy == "abort" || *liveEdit {
+		return nil, false, conflict
+	}
+	current, err := f.LoadPost(post.ID)
+	if err != nil {
+		logf("WARNING: Cannot load post %d to resolve conflict: %v", post.ID, err)
+		return nil, false, conflict
+	}
+	theirs := storedText(current.Raw)
+	merged, conflicts := merge3(storedText(rawOld), raw, theirs)
+
+	if policy == "ask" {
+		logf("Post %d was changed in the forum meanwhile. Changes made there were:", post.ID)
+		showDiff(rawOld, theirs)
+		policy = askConflictPolicy(conflicts == 0)
+	}
+
+	switch policy {
+	case "merge":
+		if conflicts > 0 {
+			return nil, false, conflict
+		}
+		logf("Merging in changes made to post %d in the forum meanwhile:", post.ID)
+		showDiff(raw, merged)
+		return f.putPost(post, merged, current.Raw)
+	case "resolve":
+		resolved, ok := resolveHunks(rawOld, raw, theirs)
+		if !ok {
+			return nil, false, conflict
+		}
+		logf("Saving content of post %d with conflicts resolved...", post.ID)
+		return f.putPost(post, resolved, current.Raw)
+	case "ours":
+		logf("Overwriting changes made to post %d in the forum meanwhile.", post.ID)
+		return f.putPost(post, raw, current.Raw)
+	case "theirs":
+		logf("WARNING: Keeping changes made to post %d in the forum meanwhile, and dropping yours.", post.ID)
+		current.Raw = theirs
+		return current, false, nil
+	}
+	return nil, false, conflict
+}
+
+// askConflictPolicy asks which policy to apply to a conflict. Merging
+// is only offered when changes do not overlap.
+func askConflictPolicy(canMerge bool) string {
+	question := "Changes overlap with yours. [r]esolve them hunk by hunk, [o]verwrite them, [d]rop yours, or [a]bort? "
+	if canMerge {
+		question = "Changes do not overlap with yours. [m]erge them, [o]verwrite them, [d]rop yours, or [a]bort? "
+	}
+	for {
+		answer, err := readLine(question)
+		if err != nil {
+			return "abort"
+		}
+		switch strings.ToLower(answer) {
+		case "m", "merge":
+			if canMerge {
+				return "merge"
+			}
+		case "r", "resolve":
+			return "resolve"
+		case "o", "overwrite":
+			return "ours"
+		case "d", "drop":
+			return "theirs"
+		case "a", "abort", "":
+			return "abort"
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/niemeyer/discedit/discourse"
+)
+
+// SlowMode reports the time required between replies to the topic by
+// the same user, or zero if the topic is not in slow mode right now.
+func (t *Topic) SlowMode(now time.Time) time.Duration {
+	if t.SlowModeSeconds <= 0 || !t.SlowModeUntil.IsZero() && t.SlowModeUntil.Before(now) {
+		return 0
+	}
+	return time.Duration(t.SlowModeSeconds) * time.Second
+}
+
+// ReplyWait reports how long the configured user must wait before the
+// forum accepts another reply to the topic, due to slow mode.
+func (t *Topic) ReplyWait(now time.Time) time.Duration {
+	interval := t.SlowMode(now)
+	if interval == 0 || t.UserLastPostedAt.IsZero() {
+		return 0
+	}
+	if wait := t.UserLastPostedAt.Add(interval).Sub(now); wait > 0 {
+		return wait.Round(time.Second)
+	}
+	return 0
+}
+
+// checkSlowMode reports up front when slow mode will delay the reply
+// about to be posted to the topic, before any work is done.
+func checkSlowMode(topic *Topic) {
+	now := time.Now()
+	interval := topic.SlowMode(now)
+	if interval == 0 {
+		return
+	}
+	wait := topic.ReplyWait(now)
+	switch {
+	case wait == 0:
+		logf("Topic is in slow mode, allowing one reply every %v.", interval)
+	case *waitCooldown:
+		logf("Topic is in slow mode, so the reply will wait %v to be posted.", wait)
+	default:
+		logf("WARNING: Topic is in slow mode, so the reply will be rejected for another %v (see -wait-cooldown).", wait)
+	}
+}
+
+// waitReply waits until slow mode allows replying to the topic, with
+// -wait-cooldown, and fails otherwise if a reply would be rejected.
+func waitReply(topic *Topic) error {
+	wait := topic.ReplyWait(time.Now())
+	if wait == 0 {
+		return nil
+	}
+	if !*waitCooldown {
+		return fmt.Errorf("topic is in slow mode, so replies are only accepted in %v (see -wait-cooldown)", wait)
+	}
+	logf("Topic is in slow mode. Waiting %v to reply...", wait)
+	time.Sleep(wait)
+	return nil
+}
+
+// waitCooldownAfter reports whether the request that failed with err
+// should be retried, after waiting as long as the forum asked to when
+// rate limiting it, which is only done with -wait-cooldown.
+func waitCooldownAfter(path string, err error) bool {
+	var limited *discourse.RateLimitedError
+	if !*waitCooldown || !errors.As(err, &limited) || limited.Wait <= 0 {
+		return false
+	}
+	logf("Forum is rate limiting requests on %s. Waiting %v to retry...", path, limited.Wait)
+	time.Sleep(limited.Wait)
+	return true
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Crosslink is a suggestion to link a term in a topic to another topic
+// in a mirror whose title matches it.
+type Crosslink struct {
+	Line    int    `json:"line"`
+	Term    string `json:"term"`
+	TopicID int    `json:"topic"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	File    string `json:"file"`
+}
+
+// minCrosslinkTitle is the shortest title suggested as a crosslink, as
+// very short titles match too much text to be useful.
+const minCrosslinkTitle = 4
+
+var (
+	inlineCodePattern = regexp.MustCompile("`[^`]*`")
+	linkTextPattern   = regexp.MustCompile(`!?\[[^\]]*\]\([^)]*\)|<[^>]*>|https?://\S+`)
+)
+
+// runAuditCrosslinks suggests links from a topic to the other topics in
+// the mirrors provided, or in the mirrors configured for the forum,
+// wherever their titles are mentioned in the topic without a link.
+func runAuditCrosslinks(config *Config, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("audit crosslinks command expects a topic URL and optional mirror directories")
+	}
+	forum, topicID, postNumber, err := openPost(config, args[0])
+	if err != nil {
+		return err
+	}
+	dirs := args[1:]
+	if len(dirs) == 0 {
+		dirs = forum.config.Mirrors
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("audit crosslinks needs mirror directories, either as arguments or in the mirrors setting of the forum")
+	}
+	topic, err := forum.LoadTopicPost(topicID, postNumber)
+	if err != nil {
+		return err
+	}
+	var candidates []*MirrorTopic
+	for _, dir := range dirs {
+		mirror, err := readMirror(dir)
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, mirror.Topics...)
+	}
+
+	links := forum.crosslinks(topic, candidates)
+
+	filename := *outputPath
+	if filename == "" {
+		filename = "-"
+	}
+	err = writeOutput(filename, func(w io.Writer) error {
+		if *jsonOutput {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "\t")
+			if links == nil {
+				links = []*Crosslink{}
+			}
+			return encoder.Encode(links)
+		}
+		for _, link := range links {
+			fmt.Fprintf(w, "line %d: %q could link to %q (%s)\n", link.Line, link.Term, link.Title, link.URL)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logf("Found %d crosslink suggestion(s) for %s.", len(links), topic)
+	return nil
+}
+
+// crosslinks returns suggestions of links from topic.Post to the
+// candidate topics whose titles are mentioned in its content, at the
+// first mention of each. Topics already linked are not suggested, nor
+// are mentions in headings, code, or existing links.
+func (f *Forum) crosslinks(topic *Topic, candidates []*MirrorTopic) []*Crosslink {
+	linked := make(map[int]bool)
+	for _, link := range f.outboundLinks(topic.Post.Raw) {
+		linked[link.TopicID] = true
+	}
+	type target struct {
+		mt      *MirrorTopic
+		pattern *regexp.Regexp
+	}
+	var targets []target
+	seen := make(map[int]bool)
+	for _, mt := range candidates {
+		title := strings.TrimSpace(mt.Title)
+		if mt.TopicID == topic.ID || linked[mt.TopicID] || seen[mt.TopicID] || len(title) < minCrosslinkTitle {
+			continue
+		}
+		seen[mt.TopicID] = true
+		pattern := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(title) + `\b`)
+		targets = append(targets, target{mt, pattern})
+	}
+	// Longer titles first, so that "Install the snap daemon" is
+	// suggested rather than "Install" when both match.
+	sort.SliceStable(targets, func(i, j int) bool {
+		return len(targets[i].mt.Title) > len(targets[j].mt.Title)
+	})
+
+	var links []*Crosslink
+	var fence string
+	for i, line := range strings.Split(topic.Post.Raw, "\n") {
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if strings.HasPrefix(m[1], fence) && strings.TrimSpace(line) == m[1] {
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" || headingPattern.MatchString(line) {
+			continue
+		}
+		blank := func(s string) string { return strings.Repeat(" ", len(s)) }
+		text := inlineCodePattern.ReplaceAllStringFunc(line, blank)
+		text = linkTextPattern.ReplaceAllStringFunc(text, blank)
+		for j, t := range targets {
+			if t.mt == nil {
+				continue
+			}
+			loc := t.pattern.FindStringIndex(text)
+			if loc == nil {
+				continue
+			}
+			links = append(links, &Crosslink{
+				Line:    i + 1,
+				Term:    line[loc[0]:loc[1]],
+				TopicID: t.mt.TopicID,
+				Title:   t.mt.Title,
+				URL:     fmt.Sprintf("%s/t/%d", f.baseURL, t.mt.TopicID),
+				File:    t.mt.File,
+			})
+			// The mention is taken, so shorter titles within it
+			// are not suggested as well.
+			text = text[:loc[0]] + blank(text[loc[0]:loc[1]]) + text[loc[1]:]
+			targets[j].mt = nil
+		}
+	}
+	return links
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/niemeyer/discedit/shlex"
+)
+
+// The configuration file may be encrypted with a passphrase for users
+// that cannot keep plain text API keys on disk. The passphrase is taken
+// from $DISCEDIT_PASSPHRASE, from the output of the command in
+// $DISCEDIT_PASSPHRASE_COMMAND (e.g. a password manager or agent),
+// or else asked for in the terminal.
+
+var encryptedHeader = []byte("discedit-encrypted-v1\n")
+
+const (
+	pbkdf2Iterations = 600000
+	saltSize         = 16
+)
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedHeader)
+}
+
+func encryptConfig(plain []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("cannot generate salt: %v", err)
+	}
+	gcm, err := configCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %v", err)
+	}
+	sealed := gcm.Seal(nil, nonce, plain, encryptedHeader)
+
+	var buf bytes.Buffer
+	buf.Write(encryptedHeader)
+	buf.WriteString(base64.StdEncoding.EncodeToString(append(append(salt, nonce...), sealed...)))
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func decryptConfig(data []byte, passphrase string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data[len(encryptedHeader):])))
+	if err != nil || len(raw) < saltSize {
+		return nil, fmt.Errorf("%s is corrupted", configPath)
+	}
+	gcm, err := configCipher(passphrase, raw[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	raw = raw[saltSize:]
+	if len(raw) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s is corrupted", configPath)
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], encryptedHeader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt %s: wrong passphrase?", configPath)
+	}
+	return plain, nil
+}
+
+func configCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2SHA256([]byte(passphrase), salt, pbkdf2Iterations, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: cannot create cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: cannot create cipher: %v", err)
+	}
+	return gcm, nil
+}
+
+// pbkdf2SHA256 derives a key from password as defined in RFC 8018.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	var counter [4]byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], block)
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+func readPassphrase(prompt string) (string, error) {
+	if passphrase := os.Getenv("DISCEDIT_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	if command := os.Getenv("DISCEDIT_PASSPHRASE_COMMAND"); command != "" {
+		args, err := shlex.Split(command)
+		if err != nil || len(args) == 0 {
+			return "", fmt.Errorf("cannot parse $DISCEDIT_PASSPHRASE_COMMAND")
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("cannot obtain passphrase from $DISCEDIT_PASSPHRASE_COMMAND: %v", err)
+		}
+		return strings.TrimRight(string(output), "\r\n"), nil
+	}
+
+	// Disable echoing where possible. Errors are fine: the
+	// passphrase will just be visible while typed.
+	if setEcho(false) == nil {
+		defer func() {
+			setEcho(true)
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	passphrase, err := readLine(prompt)
+	if err != nil {
+		return "", fmt.Errorf("cannot read passphrase: %v", err)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("no passphrase provided")
+	}
+	return passphrase, nil
+}
+
+func setEcho(on bool) error {
+	arg := "-echo"
+	if on {
+		arg = "echo"
+	}
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// runConfig implements the config command, which encrypts or decrypts
+// the configuration file in place.
+func runConfig(args []string) error {
+	if len(args) != 1 || args[0] != "encrypt" && args[0] != "decrypt" {
+		return fmt.Errorf("config command expects either encrypt or decrypt")
+	}
+	unlock, err := lockPath(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %v", configPath, err)
+	}
+	var result []byte
+	if args[0] == "encrypt" {
+		if isEncrypted(data) {
+			return fmt.Errorf("%s is already encrypted", configPath)
+		}
+		passphrase, err := readPassphrase("New passphrase: ")
+		if err != nil {
+			return err
+		}
+		if os.Getenv("DISCEDIT_PASSPHRASE") == "" && os.Getenv("DISCEDIT_PASSPHRASE_COMMAND") == "" {
+			again, err := readPassphrase("Repeat passphrase: ")
+			if err != nil {
+				return err
+			}
+			if again != passphrase {
+				return fmt.Errorf("passphrases do not match")
+			}
+		}
+		result, err = encryptConfig(data, passphrase)
+		if err != nil {
+			return err
+		}
+	} else {
+		if !isEncrypted(data) {
+			return fmt.Errorf("%s is not encrypted", configPath)
+		}
+		passphrase, err := readPassphrase("Passphrase: ")
+		if err != nil {
+			return err
+		}
+		result, err = decryptConfig(data, passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	tmpPath := configPath + ".tmp"
+	err = ioutil.WriteFile(tmpPath, result, 0600)
+	if err == nil {
+		err = os.Rename(tmpPath, configPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("cannot write %s: %v", configPath, err)
+	}
+	logf("%s is now %sed.", configPath, args[0])
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Test vectors for PBKDF2-HMAC-SHA256 from RFC 7914, section 11.
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		key        string
+	}{{
+		password:   "passwd",
+		salt:       "salt",
+		iterations: 1,
+		key: "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+			"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+	}, {
+		password:   "Password",
+		salt:       "NaCl",
+		iterations: 80000,
+		key: "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+			"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d",
+	}}
+	for _, test := range tests {
+		key := pbkdf2SHA256([]byte(test.password), []byte(test.salt), test.iterations, 64)
+		if hex.EncodeToString(key) != test.key {
+			t.Errorf("PBKDF2 of %q with %q and %d iterations:\ngot  %x\nwant %s",
+				test.password, test.salt, test.iterations, key, test.key)
+		}
+	}
+}
+
+func TestEncryptConfig(t *testing.T) {
+	plain := []byte("forums:\n    https://example.com:\n        key: secret\n")
+	data, err := encryptConfig(plain, "right")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(data) {
+		t.Fatalf("encrypted data has no header: %q", data)
+	}
+	if bytes.Contains(data, []byte("secret")) {
+		t.Fatalf("encrypted data holds the plain text")
+	}
+
+	decrypted, err := decryptConfig(data, "right")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatalf("decrypted %q, want %q", decrypted, plain)
+	}
+
+	_, err = decryptConfig(data, "wrong")
+	if err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Fatalf("decrypting with the wrong passphrase: %v", err)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data[len(encryptedHeader):])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reencode := func(raw []byte) []byte {
+		return append(append([]byte(nil), encryptedHeader...), base64.StdEncoding.EncodeToString(raw)+"\n"...)
+	}
+
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = decryptConfig(reencode(tampered), "right")
+	if err == nil {
+		t.Fatalf("tampered ciphertext was decrypted")
+	}
+
+	for _, size := range []int{len(raw) - 1, saltSize + 4, saltSize - 1, 0} {
+		_, err = decryptConfig(reencode(raw[:size]), "right")
+		if err == nil {
+			t.Fatalf("ciphertext truncated to %d bytes was decrypted", size)
+		}
+	}
+
+	_, err = decryptConfig(append(append([]byte(nil), encryptedHeader...), "not base64!\n"...), "right")
+	if err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Fatalf("decrypting invalid data: %v", err)
+	}
+}
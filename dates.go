@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dateDirectivePattern matches {date:...} directives in the edited
+// content, such as {date:2021-05-04 15:00 Europe/Berlin}.
+var dateDirectivePattern = regexp.MustCompile(`\{date:([^{}\n]+)\}`)
+
+var dateLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// expandDates replaces {date:...} directives outside of code in text
+// with the equivalent Discourse local date markup, so that readers see
+// dates in their own timezone. Directives hold an ISO date and time,
+// optionally followed by a timezone name, and otherwise are taken to
+// be in the local timezone. Directives that cannot be parsed are left
+// alone and reported as problems.
+func expandDates(text string) (result string, problems []string) {
+	var buf strings.Builder
+	last := 0
+	for _, loc := range dateDirectivePattern.FindAllStringSubmatchIndex(withoutCode(text), -1) {
+		markup, err := dateMarkup(text[loc[2]:loc[3]])
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		buf.WriteString(text[last:loc[0]])
+		buf.WriteString(markup)
+		last = loc[1]
+	}
+	buf.WriteString(text[last:])
+	return buf.String(), problems
+}
+
+// dateMarkup returns the Discourse local date markup for the value
+// of a {date:...} directive.
+func dateMarkup(value string) (string, error) {
+	fields := strings.Fields(value)
+	timezone := localTimezone()
+	if n := len(fields); n > 1 && !strings.Contains(fields[n-1], ":") {
+		timezone = fields[n-1]
+		fields = fields[:n-1]
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			return "", fmt.Errorf("unknown timezone in {date:%s}", value)
+		}
+	}
+	stamp := strings.Join(fields, " ")
+
+	if t, err := time.Parse(time.RFC3339, stamp); err == nil {
+		t = t.UTC()
+		return fmt.Sprintf(`[date=%s time=%s timezone="UTC"]`, t.Format("2006-01-02"), t.Format("15:04:05")), nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, stamp); err == nil {
+			return fmt.Sprintf(`[date=%s time=%s timezone=%q]`, t.Format("2006-01-02"), t.Format("15:04:05"), timezone), nil
+		}
+	}
+	if t, err := time.Parse("2006-01-02", stamp); err == nil {
+		return fmt.Sprintf(`[date=%s timezone=%q]`, t.Format("2006-01-02"), timezone), nil
+	}
+	return "", fmt.Errorf("invalid date in {date:%s} (use \"2006-01-02 15:04 [timezone]\")", value)
+}
+
+// localTimezone returns the IANA name of the local timezone, or UTC
+// if it cannot be determined.
+func localTimezone() string {
+	if tz := os.Getenv("TZ"); tz != "" {
+		return strings.TrimPrefix(tz, ":")
+	}
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if i := strings.Index(target, "zoneinfo/"); i >= 0 {
+			return target[i+len("zoneinfo/"):]
+		}
+	}
+	return "UTC"
+}
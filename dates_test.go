@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpandDates(t *testing.T) {
+	oldTZ, hadTZ := os.LookupEnv("TZ")
+	os.Setenv("TZ", "America/Sao_Paulo")
+	defer func() {
+		if hadTZ {
+			os.Setenv("TZ", oldTZ)
+		} else {
+			os.Unsetenv("TZ")
+		}
+	}()
+
+	tests := []struct {
+		summary  string
+		input    string
+		output   string
+		problems int
+	}{{
+		summary: "Bare date",
+		input:   "On {date:2021-05-04}.",
+		output:  `On [date=2021-05-04 timezone="America/Sao_Paulo"].`,
+	}, {
+		summary: "Date and time in the local timezone",
+		input:   "At {date:2021-05-04 15:00}.",
+		output:  `At [date=2021-05-04 time=15:00:00 timezone="America/Sao_Paulo"].`,
+	}, {
+		summary: "Date and time with a timezone name",
+		input:   "At {date:2021-05-04T15:00:30 Europe/Berlin}.",
+		output:  `At [date=2021-05-04 time=15:00:30 timezone="Europe/Berlin"].`,
+	}, {
+		summary: "RFC3339 with a timezone offset",
+		input:   "At {date:2021-05-04T15:00:00+02:00}.",
+		output:  `At [date=2021-05-04 time=13:00:00 timezone="UTC"].`,
+	}, {
+		summary:  "Invalid stamp",
+		input:    "At {date:2021-13-45}.",
+		output:   "At {date:2021-13-45}.",
+		problems: 1,
+	}, {
+		summary:  "Unknown timezone",
+		input:    "At {date:2021-05-04 15:00 Mars/Olympus}.",
+		output:   "At {date:2021-05-04 15:00 Mars/Olympus}.",
+		problems: 1,
+	}, {
+		summary: "Directives inside code",
+		input:   "Use `{date:2021-05-04}` or\n\n```\n{date:2021-05-04}\n```\n",
+		output:  "Use `{date:2021-05-04}` or\n\n```\n{date:2021-05-04}\n```\n",
+	}, {
+		summary:  "Valid and invalid directives together",
+		input:    "{date:bogus} then {date:2021-05-04}",
+		output:   `{date:bogus} then [date=2021-05-04 timezone="America/Sao_Paulo"]`,
+		problems: 1,
+	}}
+	for _, test := range tests {
+		output, problems := expandDates(test.input)
+		if output != test.output || len(problems) != test.problems {
+			t.Errorf("%s:\noutput: %q (problems: %q)\nwant:   %q (%d problems)",
+				test.summary, output, problems, test.output, test.problems)
+		}
+	}
+}
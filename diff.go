@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffEdit is a single line in an edit script, as produced by diffLines.
+type diffEdit struct {
+	Op   byte // ' ' for unchanged lines, '-' for deletions, '+' for insertions.
+	Line string
+}
+
+// splitLines breaks text into lines, without their line terminators.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the shortest edit script that turns a into b,
+// computed with Myers' algorithm.
+func diffLines(a, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	var d int
+outer:
+	for d = 0; d <= max; d++ {
+		vc := make([]int, len(v))
+		copy(vc, v)
+		trace = append(trace, vc)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break outer
+			}
+		}
+	}
+
+	// Walk the trace backwards to recover the edit script.
+	var edits []diffEdit
+	x, y := n, m
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, diffEdit{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, diffEdit{'+', b[y]})
+		} else {
+			x--
+			edits = append(edits, diffEdit{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, diffEdit{' ', a[x]})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// diffLinesIgnoringWhitespace works like diffLines, but considers
+// lines that differ only in the amount of whitespace as equal. Unchanged lines
+// are reported as they are in b.
+func diffLinesIgnoringWhitespace(a, b []string) []diffEdit {
+	ka := make([]string, len(a))
+	for i, line := range a {
+		ka[i] = collapseWhitespace(line)
+	}
+	kb := make([]string, len(b))
+	for i, line := range b {
+		kb[i] = collapseWhitespace(line)
+	}
+	edits := diffLines(ka, kb)
+	var x, y int
+	for i := range edits {
+		switch edits[i].Op {
+		case ' ':
+			edits[i].Line = b[y]
+			x++
+			y++
+		case '-':
+			edits[i].Line = a[x]
+			x++
+		case '+':
+			edits[i].Line = b[y]
+			y++
+		}
+	}
+	return edits
+}
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+// unifiedDiff returns the changes between the old and new texts in
+// the unified diff format, or an empty string if they are equal.
+//
+// With -ignore-whitespace, lines that differ only in the amount of
+// whitespace are considered unchanged.
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+	var edits []diffEdit
+	if *ignoreWhitespace {
+		edits = diffLinesIgnoringWhitespace(oldLines, newLines)
+	} else {
+		edits = diffLines(oldLines, newLines)
+	}
+
+	var buf strings.Builder
+	for start := 0; start < len(edits); {
+		// Find the next change and the extent of its hunk.
+		for start < len(edits) && edits[start].Op == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		last := start
+		for i := start; i < len(edits); i++ {
+			if edits[i].Op != ' ' {
+				last = i
+			} else if i-last > 2*diffContext {
+				break
+			}
+		}
+		end := last + diffContext + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		// Compute the line positions of the hunk.
+		oldLine, newLine := 1, 1
+		for _, e := range edits[:first] {
+			if e.Op != '+' {
+				oldLine++
+			}
+			if e.Op != '-' {
+				newLine++
+			}
+		}
+		var oldCount, newCount int
+		for _, e := range edits[first:end] {
+			if e.Op != '+' {
+				oldCount++
+			}
+			if e.Op != '-' {
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldLine--
+		}
+		if newCount == 0 {
+			newLine--
+		}
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+		for _, e := range edits[first:end] {
+			buf.WriteByte(e.Op)
+			buf.WriteString(e.Line)
+			buf.WriteByte('\n')
+		}
+		start = end
+	}
+	return buf.String()
+}
+
+// diffStat returns how many lines were added and removed to turn
+// oldText into newText.
+func diffStat(oldText, newText string) (added, removed int) {
+	for _, e := range diffLines(splitLines(oldText), splitLines(newText)) {
+		switch e.Op {
+		case '+':
+			added++
+		case '-':
+			removed++
+		}
+	}
+	return added, removed
+}
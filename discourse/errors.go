@@ -0,0 +1,105 @@
+// Package discourse holds the errors returned by requests to a Discourse
+// forum, so that programs driving discedit or talking to a forum on their
+// own may tell the most common failures apart with errors.As and implement
+// their own retry and merge logic.
+package discourse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// NotFoundError is returned when the requested resource does not exist,
+// or is not visible to the configured user.
+type NotFoundError struct {
+	Message string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Message
+}
+
+// ConflictError is returned when the content being saved was changed
+// by someone else since it was loaded.
+type ConflictError struct {
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return "someone else edited the same content meanwhile"
+}
+
+// RateLimitedError is returned when the forum refuses a request for
+// exceeding its rate limits. Wait is how long the forum asks to wait
+// before retrying, or zero if it didn't say.
+type RateLimitedError struct {
+	Wait time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.Wait > 0 {
+		return fmt.Sprintf("rate limited by the forum, retry in %v", e.Wait)
+	}
+	return "rate limited by the forum"
+}
+
+// UnauthorizedError is returned when the configured user is not allowed
+// to perform the request.
+type UnauthorizedError struct {
+	Message string
+}
+
+func (e *UnauthorizedError) Error() string {
+	return e.Message
+}
+
+// CheckResponse returns nil if resp, requested for path and holding
+// data in its body, reports success. Otherwise it returns one of the
+// error types in this package, or an error with the message Discourse
+// sent along for other failures.
+func CheckResponse(resp *http.Response, data []byte, path string) error {
+	switch resp.StatusCode {
+	case 200:
+		return nil
+	case 401:
+		return &UnauthorizedError{Message: fmt.Sprintf("forum refused the configured API key on %s (is it valid?)", path)}
+	case 404:
+		return &NotFoundError{fmt.Sprintf("resource not found: %s", path)}
+	case 409:
+		return &ConflictError{Path: path}
+	case 429:
+		return &RateLimitedError{Wait: retryAfter(resp, data)}
+	}
+
+	var result struct {
+		Errors []string `json:"errors"`
+	}
+	msg := fmt.Sprintf("got %d status", resp.StatusCode)
+	if json.Unmarshal(data, &result) == nil && len(result.Errors) > 0 {
+		msg = result.Errors[0]
+	}
+	if resp.StatusCode == 403 {
+		return &UnauthorizedError{Message: "cannot perform request: " + msg}
+	}
+	return fmt.Errorf("cannot perform request: %s", msg)
+}
+
+// retryAfter returns how long a rate limited response asks to wait,
+// either via the Retry-After header or the body Discourse sends along.
+func retryAfter(resp *http.Response, data []byte) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	var result struct {
+		Extras struct {
+			WaitSeconds int `json:"wait_seconds"`
+		} `json:"extras"`
+	}
+	if json.Unmarshal(data, &result) == nil {
+		return time.Duration(result.Extras.WaitSeconds) * time.Second
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+package discourse_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/niemeyer/discedit/discourse"
+)
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		status int
+		header http.Header
+		body   string
+		check  func(err error) bool
+		msg    string
+	}{{
+		status: 200,
+		check:  func(err error) bool { return err == nil },
+	}, {
+		status: 404,
+		check:  func(err error) bool { var e *discourse.NotFoundError; return errors.As(err, &e) },
+		msg:    "resource not found: /t/1.json",
+	}, {
+		status: 409,
+		check: func(err error) bool {
+			var e *discourse.ConflictError
+			return errors.As(err, &e) && e.Path == "/t/1.json"
+		},
+		msg: "someone else edited the same content meanwhile",
+	}, {
+		status: 429,
+		header: http.Header{"Retry-After": {"7"}},
+		check: func(err error) bool {
+			var e *discourse.RateLimitedError
+			return errors.As(err, &e) && e.Wait == 7*time.Second
+		},
+		msg: "rate limited by the forum, retry in 7s",
+	}, {
+		status: 429,
+		body:   `{"extras": {"wait_seconds": 3}}`,
+		check: func(err error) bool {
+			var e *discourse.RateLimitedError
+			return errors.As(err, &e) && e.Wait == 3*time.Second
+		},
+		msg: "rate limited by the forum, retry in 3s",
+	}, {
+		status: 401,
+		check:  func(err error) bool { var e *discourse.UnauthorizedError; return errors.As(err, &e) },
+		msg:    "forum refused the configured API key on /t/1.json (is it valid?)",
+	}, {
+		status: 403,
+		body:   `{"errors": ["You are not permitted to view the requested resource."]}`,
+		check:  func(err error) bool { var e *discourse.UnauthorizedError; return errors.As(err, &e) },
+		msg:    "cannot perform request: You are not permitted to view the requested resource.",
+	}, {
+		status: 422,
+		body:   `{"errors": ["Body is too short"]}`,
+		check:  func(err error) bool { return err != nil },
+		msg:    "cannot perform request: Body is too short",
+	}, {
+		status: 500,
+		body:   "<html>",
+		check:  func(err error) bool { return err != nil },
+		msg:    "cannot perform request: got 500 status",
+	}}
+	for _, test := range tests {
+		resp := &http.Response{StatusCode: test.status, Header: test.header}
+		err := discourse.CheckResponse(resp, []byte(test.body), "/t/1.json")
+		if !test.check(err) {
+			t.Errorf("status %d: unexpected error %#v", test.status, err)
+		} else if err != nil && err.Error() != test.msg {
+			t.Errorf("status %d:\ngot  %q\nwant %q", test.status, err, test.msg)
+		}
+	}
+}
@@ -0,0 +1,473 @@
+// Package discoursetest implements a small fake Discourse server for
+// testing code that talks to a forum, such as discedit itself.
+//
+// Only the parts of the Discourse API used by discedit are implemented,
+// with just enough behavior to exercise it: topics and their posts,
+// edits with conflict detection, drafts, and rate limiting.
+package discoursetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a fake Discourse server. All of its methods may be called
+// while it serves requests.
+type Server struct {
+	// URL is the base URL of the forum, with no trailing slash.
+	URL string
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	topics   map[int]*Topic
+	posts    map[int]*Post
+	drafts   map[string]*draft
+	failures []failure
+	lastID   int
+	requests int
+
+	notModified int
+}
+
+// Topic is a topic in the fake forum.
+type Topic struct {
+	ID         int
+	Slug       string
+	Title      string
+	CategoryID int
+	Posts      []*Post
+}
+
+// Post is a post in the fake forum.
+type Post struct {
+	ID         int
+	TopicID    int
+	PostNumber int
+	Username   string
+	Raw        string
+	Version    int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Wiki       bool
+	Locked     bool
+}
+
+type draft struct {
+	sequence int
+	data     string
+}
+
+type failure struct {
+	status int
+	wait   int
+}
+
+// NewServer starts and returns a new fake Discourse server, which must
+// be closed with Close once done.
+func NewServer() *Server {
+	s := &Server{
+		topics: make(map[int]*Topic),
+		posts:  make(map[int]*Post),
+		drafts: make(map[string]*draft),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// AddTopic creates a topic with the given title and first post content,
+// and returns it.
+func (s *Server) AddTopic(title, raw string) *Topic {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	topic := &Topic{
+		ID:    s.lastID,
+		Slug:  slugPattern.ReplaceAllString(strings.ToLower(title), "-"),
+		Title: title,
+	}
+	s.topics[topic.ID] = topic
+	s.addPost(topic, "system", raw)
+	return topic
+}
+
+// AddPost adds a reply with the given content to the topic, and returns it.
+func (s *Server) AddPost(topicID int, username, raw string) *Post {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addPost(s.topics[topicID], username, raw)
+}
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+func (s *Server) addPost(topic *Topic, username, raw string) *Post {
+	s.lastID++
+	now := time.Now()
+	post := &Post{
+		ID:         s.lastID,
+		TopicID:    topic.ID,
+		PostNumber: len(topic.Posts) + 1,
+		Username:   username,
+		Raw:        raw,
+		Version:    1,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	topic.Posts = append(topic.Posts, post)
+	s.posts[post.ID] = post
+	return post
+}
+
+// Edit changes the content of the post as if someone else edited it.
+func (s *Server) Edit(postID int, raw string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post := s.posts[postID]
+	post.Raw = raw
+	post.Version++
+	post.UpdatedAt = time.Now()
+}
+
+// Raw returns the current content of the post.
+func (s *Server) Raw(postID int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.posts[postID].Raw
+}
+
+// Version returns the current version of the post.
+func (s *Server) Version(postID int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.posts[postID].Version
+}
+
+// Draft returns the data of the draft with the given key, as sent by
+// the client, or an empty string if there is no such draft.
+func (s *Server) Draft(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.drafts[key]; ok {
+		return d.data
+	}
+	return ""
+}
+
+// Fail has the next request fail with the given status.
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{status: status})
+}
+
+// RateLimit has the next request rejected for exceeding rate limits,
+// asking the client to wait for the given number of seconds.
+func (s *Server) RateLimit(waitSeconds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{status: 429, wait: waitSeconds})
+}
+
+// Requests returns the number of requests served so far.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// NotModified returns the number of conditional requests answered with
+// no content, as the resource was not modified.
+func (s *Server) NotModified() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notModified
+}
+
+var (
+	topicPath    = regexp.MustCompile(`^/t/([0-9]+)\.json$`)
+	topicPosts   = regexp.MustCompile(`^/t/([0-9]+)/posts\.json$`)
+	rawPath      = regexp.MustCompile(`^/raw/([0-9]+)/([0-9]+)$`)
+	postPath     = regexp.MustCompile(`^/posts/([0-9]+)\.json$`)
+	postByNumber = regexp.MustCompile(`^/posts/by_number/([0-9]+)/([0-9]+)\.json$`)
+	lastRevision = regexp.MustCompile(`^/posts/([0-9]+)/revisions/latest\.json$`)
+)
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	if len(s.failures) > 0 {
+		f := s.failures[0]
+		s.failures = s.failures[1:]
+		if f.wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(f.wait))
+		}
+		writeError(w, f.status, fmt.Sprintf("fake failure with status %d", f.status))
+		return
+	}
+
+	path := r.URL.Path
+	var m []string
+	match := func(method string, pattern *regexp.Regexp) bool {
+		if r.Method != method {
+			return false
+		}
+		m = pattern.FindStringSubmatch(path)
+		return m != nil
+	}
+	atoi := func(i int) int {
+		n, _ := strconv.Atoi(m[i])
+		return n
+	}
+
+	switch {
+	case r.Method == "GET" && path == "/about.json":
+		writeJSON(w, map[string]interface{}{"about": map[string]string{"version": "3.2.0"}})
+	case r.Method == "GET" && path == "/session/current.json":
+		writeJSON(w, map[string]interface{}{"current_user": map[string]string{"username": r.Header.Get("Api-Username")}})
+	case match("GET", topicPath):
+		s.serveTopic(w, atoi(1))
+	case match("GET", topicPosts):
+		s.serveTopicPosts(w, r, atoi(1))
+	case match("GET", rawPath):
+		post := s.postByNumber(atoi(1), atoi(2))
+		if post == nil {
+			writeError(w, 404, "not found")
+			return
+		}
+		fmt.Fprint(w, post.Raw)
+	case match("GET", postPath):
+		s.servePost(w, r, s.posts[atoi(1)])
+	case match("GET", postByNumber):
+		s.servePost(w, r, s.postByNumber(atoi(1), atoi(2)))
+	case match("GET", lastRevision):
+		post := s.posts[atoi(1)]
+		if post == nil || post.Version < 2 {
+			writeError(w, 404, "not found")
+			return
+		}
+		writeJSON(w, map[string]interface{}{"username": "someone", "created_at": post.UpdatedAt})
+	case match("PUT", postPath):
+		s.updatePost(w, r, s.posts[atoi(1)])
+	case r.Method == "POST" && path == "/posts.json":
+		s.createPost(w, r)
+	case r.Method == "GET" && path == "/draft.json":
+		key := r.URL.Query().Get("draft_key")
+		result := map[string]interface{}{"draft": nil, "draft_sequence": 0}
+		if d, ok := s.drafts[key]; ok {
+			if d.data != "" {
+				result["draft"] = d.data
+			}
+			result["draft_sequence"] = d.sequence
+		}
+		writeJSON(w, result)
+	case r.Method == "POST" && path == "/draft.json":
+		s.saveDraft(w, r)
+	default:
+		writeError(w, 404, "not found")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{msg}})
+}
+
+func (s *Server) postByNumber(topicID, postNumber int) *Post {
+	topic := s.topics[topicID]
+	if topic == nil || postNumber < 1 || postNumber > len(topic.Posts) {
+		return nil
+	}
+	return topic.Posts[postNumber-1]
+}
+
+func (s *Server) postJSON(post *Post) map[string]interface{} {
+	topic := s.topics[post.TopicID]
+	return map[string]interface{}{
+		"id":          post.ID,
+		"topic_id":    post.TopicID,
+		"topic_slug":  topic.Slug,
+		"post_number": post.PostNumber,
+		"username":    post.Username,
+		"raw":         post.Raw,
+		"cooked":      "<p>" + html.EscapeString(post.Raw) + "</p>",
+		"version":     post.Version,
+		"created_at":  post.CreatedAt,
+		"updated_at":  post.UpdatedAt,
+		"wiki":        post.Wiki,
+		"can_edit":    !post.Locked,
+	}
+}
+
+func (s *Server) serveTopic(w http.ResponseWriter, topicID int) {
+	topic := s.topics[topicID]
+	if topic == nil {
+		writeError(w, 404, "not found")
+		return
+	}
+	var posts []interface{}
+	var stream []int
+	for _, post := range topic.Posts {
+		posts = append(posts, s.postJSON(post))
+		stream = append(stream, post.ID)
+	}
+	writeJSON(w, map[string]interface{}{
+		"id":             topic.ID,
+		"slug":           topic.Slug,
+		"title":          topic.Title,
+		"category_id":    topic.CategoryID,
+		"draft_key":      fmt.Sprintf("topic_%d", topic.ID),
+		"draft_sequence": 0,
+		"tags":           []string{},
+		"post_stream": map[string]interface{}{
+			"posts":  posts,
+			"stream": stream,
+		},
+	})
+}
+
+func (s *Server) serveTopicPosts(w http.ResponseWriter, r *http.Request, topicID int) {
+	var posts []interface{}
+	for _, id := range r.URL.Query()["post_ids[]"] {
+		n, _ := strconv.Atoi(id)
+		if post := s.posts[n]; post != nil && post.TopicID == topicID {
+			posts = append(posts, s.postJSON(post))
+		}
+	}
+	writeJSON(w, map[string]interface{}{"post_stream": map[string]interface{}{"posts": posts}})
+}
+
+// servePost responds with the post, along with an ETag that changes
+// with its version, and honors If-None-Match as Discourse does.
+func (s *Server) servePost(w http.ResponseWriter, r *http.Request, post *Post) {
+	if post == nil {
+		writeError(w, 404, "not found")
+		return
+	}
+	etag := fmt.Sprintf(`W/"%d-%d"`, post.ID, post.Version)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		s.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, s.postJSON(post))
+}
+
+func (s *Server) updatePost(w http.ResponseWriter, r *http.Request, post *Post) {
+	if post == nil {
+		writeError(w, 404, "not found")
+		return
+	}
+	var body struct {
+		Post struct {
+			Raw    string  `json:"raw"`
+			RawOld *string `json:"raw_old"`
+		} `json:"post"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	if post.Locked {
+		writeError(w, 403, "You are not permitted to edit this post.")
+		return
+	}
+	if body.Post.RawOld != nil && *body.Post.RawOld != post.Raw {
+		writeError(w, 409, "That post was edited by someone else.")
+		return
+	}
+	post.Raw = strings.TrimSpace(body.Post.Raw)
+	post.Version++
+	post.UpdatedAt = time.Now()
+	writeJSON(w, map[string]interface{}{"post": s.postJSON(post)})
+}
+
+func (s *Server) createPost(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		TopicID  int    `json:"topic_id"`
+		Title    string `json:"title"`
+		Raw      string `json:"raw"`
+		DraftKey string `json:"draft_key"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	username := r.Header.Get("Api-Username")
+	if body.TopicID == 0 {
+		s.lastID++
+		topic := &Topic{
+			ID:    s.lastID,
+			Slug:  slugPattern.ReplaceAllString(strings.ToLower(body.Title), "-"),
+			Title: body.Title,
+		}
+		s.topics[topic.ID] = topic
+		body.TopicID = topic.ID
+	}
+	topic := s.topics[body.TopicID]
+	if topic == nil {
+		writeError(w, 404, "not found")
+		return
+	}
+	// As in Discourse, the draft the post was written in is done.
+	if d := s.drafts[body.DraftKey]; d != nil {
+		d.sequence++
+		d.data = ""
+	}
+	writeJSON(w, s.postJSON(s.addPost(topic, username, body.Raw)))
+}
+
+func (s *Server) saveDraft(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Key      string `json:"draft_key"`
+		Sequence int    `json:"sequence"`
+		Data     string `json:"data"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	d := s.drafts[body.Key]
+	if d == nil {
+		d = &draft{}
+		s.drafts[body.Key] = d
+	}
+	if body.Sequence != d.sequence {
+		writeError(w, 409, "Draft was changed elsewhere.")
+		return
+	}
+	d.sequence++
+	d.data = body.Data
+	writeJSON(w, map[string]interface{}{"success": "OK", "draft_sequence": d.sequence})
+}
+
+func readJSON(r *http.Request, value interface{}) error {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
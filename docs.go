@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// runDocs lists the topics indexed by the discourse-docs plugin.
+func runDocs(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("docs command expects a single forum URL")
+	}
+	baseURL, err := parseForumURL(config.expandAlias(args[0]))
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, baseURL)
+	if err != nil {
+		return err
+	}
+	topics, err := forum.LoadDocs()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, topic := range topics {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", topic.ForumURL(forum), topic.Title, strings.Join(topic.Tags, ", "))
+	}
+	return w.Flush()
+}
+
+// LoadDocs returns all topics indexed by the discourse-docs plugin.
+func (f *Forum) LoadDocs() ([]*Topic, error) {
+
+	logf("Loading docs index...")
+
+	var topics []*Topic
+	for page := 0; ; page++ {
+		var result struct {
+			Topics struct {
+				TopicList struct {
+					Topics []*Topic `json:"topics"`
+				} `json:"topic_list"`
+			} `json:"topics"`
+			TopicCount int `json:"topic_count"`
+		}
+		err := f.do("GET", "/docs.json?page="+strconv.Itoa(page), nil, &result)
+		if isNotFound(err) {
+			return nil, fmt.Errorf("forum %s does not seem to run the docs plugin", f.baseURL)
+		}
+		if err != nil {
+			return nil, err
+		}
+		pageTopics := result.Topics.TopicList.Topics
+		topics = append(topics, pageTopics...)
+		if len(pageTopics) == 0 || len(topics) >= result.TopicCount {
+			break
+		}
+	}
+	return topics, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// runDraft moves server drafts to and from local files, so that work
+// in progress may be backed up or continued on another machine.
+func runDraft(config *Config, args []string) error {
+	if len(args) < 2 || args[0] != "get" && args[0] != "put" {
+		return fmt.Errorf("draft command expects get or put, and a topic URL")
+	}
+	action := args[0]
+	args = subcommandArgs(args[1:])
+	if len(args) == 0 {
+		return fmt.Errorf("draft %s expects a topic URL", action)
+	}
+	forum, topicID, postNumber, err := openPost(config, args[0])
+	if err != nil {
+		return err
+	}
+	topic, err := forum.LoadTopicPost(topicID, postNumber)
+	if err != nil {
+		return err
+	}
+	err = forum.LoadDraft(topic)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if forum.noDrafts {
+		return errNoDrafts
+	}
+
+	if action == "get" {
+		if len(args) != 1 {
+			return fmt.Errorf("draft get expects a single topic URL")
+		}
+		if topic.Draft == nil {
+			return fmt.Errorf("there is no draft for %s", topic)
+		}
+		filename := *outputPath
+		if filename == "" {
+			filename = "-"
+		}
+		return writeOutput(filename, func(w io.Writer) error {
+			_, err := io.WriteString(w, topic.Draft.EditText())
+			return err
+		})
+	}
+
+	if len(args) != 2 {
+		return fmt.Errorf("draft put expects a topic URL and a file")
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		logf("Dry run: not saving draft for %s.", topic)
+		return nil
+	}
+	return forum.SaveDraft(topic, args[1])
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// emojiCacheAge is how long the emoji names known by a forum are cached.
+const emojiCacheAge = 24 * time.Hour
+
+// Emojis returns the names of all emojis known by the forum, including
+// custom ones, or nil if they cannot be obtained.
+func (f *Forum) Emojis() map[string]bool {
+	key := f.baseURL + " emojis"
+	var names []string
+	if !cacheGet(key, emojiCacheAge, &names) || names == nil {
+		logf("Checking available emojis...")
+
+		var groups map[string][]struct {
+			Name string `json:"name"`
+		}
+		err := f.do("GET", "/emojis.json", nil, &groups)
+		if err != nil {
+			debugf("Cannot obtain emoji list: %v", err)
+			return nil
+		}
+		for _, group := range groups {
+			for _, emoji := range group {
+				names = append(names, emoji.Name)
+			}
+		}
+
+		// Custom emojis are only listed for administrators.
+		var custom []struct {
+			Name string `json:"name"`
+		}
+		err = f.do("GET", "/admin/customize/emojis.json", nil, &custom)
+		if err != nil {
+			debugf("Cannot obtain custom emoji list: %v", err)
+		}
+		for _, emoji := range custom {
+			names = append(names, emoji.Name)
+		}
+
+		sort.Strings(names)
+		err = cacheSet(key, names)
+		if err != nil {
+			debugf("Cannot cache emoji list: %v", err)
+		}
+	}
+	emojis := make(map[string]bool)
+	for _, name := range names {
+		emojis[name] = true
+	}
+	return emojis
+}
+
+var emojiPattern = regexp.MustCompile(`(?:^|[\s(\[>])(:([a-z0-9_+-]+):)(?:t[1-6]:)?`)
+var numberPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// checkEmojis returns a warning for each distinct emoji shortcode in text
+// that the forum does not know about, as these render literally.
+func checkEmojis(forum *Forum, text string) []string {
+	var problems []string
+	var emojis map[string]bool
+	seen := make(map[string]bool)
+	for _, m := range emojiPattern.FindAllStringSubmatch(withoutCode(text), -1) {
+		name := m[2]
+		if seen[name] || numberPattern.MatchString(name) {
+			continue
+		}
+		seen[name] = true
+		if emojis == nil {
+			emojis = forum.Emojis()
+			if emojis == nil {
+				return nil
+			}
+		}
+		if !emojis[name] {
+			problems = append(problems, fmt.Sprintf("unknown emoji %s will render literally", m[1]))
+		}
+	}
+	return problems
+}
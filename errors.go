@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/niemeyer/discedit/discourse"
+)
+
+// Forum requests return the error types in the discourse package, so
+// that callers may tell the most common failures apart with errors.As.
+
+func isNotFound(err error) bool {
+	var notFound *discourse.NotFoundError
+	return errors.As(err, &notFound)
+}
+
+func isConflict(err error) bool {
+	var conflict *discourse.ConflictError
+	return errors.As(err, &conflict)
+}
+
+func isUnauthorized(err error) bool {
+	var denied *discourse.UnauthorizedError
+	return errors.As(err, &denied)
+}
+
+// errNoDrafts is returned when saving a draft with an API key that is
+// not allowed to use drafts. See Forum.noDrafts.
+var errNoDrafts = errors.New("API key is not allowed to use drafts")
+
+// errNotModified is returned for conditional requests when the resource
+// still matches the ETag sent along with them.
+var errNotModified = errors.New("resource not modified")
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runExportThread(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("export-thread command expects a single topic URL")
+	}
+	forum, topicID, err := openTopic(config, args[0])
+	if err != nil {
+		return err
+	}
+	stats.Phase("load")
+	topic, err := forum.LoadTopic(topicID)
+	if err != nil {
+		return err
+	}
+	err = forum.LoadAllPosts(topic)
+	if err != nil {
+		return err
+	}
+
+	if *allPosts {
+		dir := *outputPath
+		if dir == "" {
+			dir = fmt.Sprintf("%s-%d", topic.Slug, topic.ID)
+		}
+		return exportPosts(dir, forum, topic)
+	}
+
+	filename := *outputPath
+	if filename == "" {
+		filename = fmt.Sprintf("%s-%d.md", topic.Slug, topic.ID)
+	}
+	return writeOutput(filename, func(w io.Writer) error {
+		return exportThread(w, forum, topic)
+	})
+}
+
+func runPrint(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("print command expects a single topic URL")
+	}
+	forum, topicID, postNumber, err := openPost(config, args[0])
+	if err != nil {
+		return err
+	}
+	raw, err := forum.LoadRaw(topicID, postNumber)
+	if err != nil {
+		return err
+	}
+
+	filename := *outputPath
+	if filename == "" {
+		filename = "-"
+	}
+	return writeOutput(filename, func(w io.Writer) error {
+		_, err := io.WriteString(w, strings.TrimSpace(raw)+"\n")
+		return err
+	})
+}
+
+// writeOutput calls write with a writer for the named file,
+// or for the standard output if filename is "-".
+func writeOutput(filename string, write func(w io.Writer) error) error {
+	if filename == "-" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("cannot create output file: %v", err)
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return fmt.Errorf("cannot write %s: %v", filename, err)
+	}
+	logf("Wrote %s.", filename)
+	return nil
+}
+
+// exportThread writes the raw content of every post in the topic
+// as a single markdown document, with a header for each post.
+func exportThread(w io.Writer, forum *Forum, topic *Topic) error {
+	_, err := fmt.Fprintf(w, "# %s\n\n<%s>\n", topic.Title, topic.ForumURL(forum))
+	if err != nil {
+		return err
+	}
+	for _, post := range topic.Posts {
+		_, err = fmt.Fprintf(w, "\n---\n\n## #%d @%s (%s)\n\n%s\n",
+			post.PostNumber, post.Username, post.CreatedAt.UTC().Format("2006-01-02 15:04 MST"),
+			strings.TrimSpace(post.Raw))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportPosts writes the raw content of every post in the topic to its
+// own file in dir, named after the post number, along with an index.md
+// file listing all posts.
+func exportPosts(dir string, forum *Forum, topic *Topic) error {
+	if dir == "-" {
+		return fmt.Errorf("cannot write multiple posts to the standard output")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create output directory: %v", err)
+	}
+	for _, post := range topic.Posts {
+		filename := filepath.Join(dir, postFilename(post))
+		err := writeOutput(filename, func(w io.Writer) error {
+			_, err := io.WriteString(w, strings.TrimSpace(post.Raw)+"\n")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return writeOutput(filepath.Join(dir, "index.md"), func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "# %s\n\n<%s>\n\n", topic.Title, topic.ForumURL(forum))
+		if err != nil {
+			return err
+		}
+		for _, post := range topic.Posts {
+			_, err = fmt.Fprintf(w, "* [#%d](%s) @%s (%s)\n",
+				post.PostNumber, postFilename(post), post.Username,
+				post.CreatedAt.UTC().Format("2006-01-02 15:04 MST"))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// postFilename returns the name of the file holding post when
+// exported with -all-posts. Numbers are padded so files sort well.
+func postFilename(post *Post) string {
+	return fmt.Sprintf("%04d.md", post.PostNumber)
+}
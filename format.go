@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// tableDelimiterPattern matches the row separating a markdown table
+// header from its body, such as "| --- | :-: |".
+var tableDelimiterPattern = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+// fencePattern matches lines that open or close fenced code blocks.
+var fencePattern = regexp.MustCompile("^\\s*(```+|~~~+)")
+
+// alignTables returns text with all markdown tables aligned and padded
+// so that their columns line up. Content inside fenced code blocks is
+// left untouched.
+func alignTables(text string) string {
+	lines := strings.Split(text, "\n")
+	var result []string
+	var fence string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if strings.HasPrefix(m[1], fence) && strings.TrimSpace(line) == m[1] {
+				fence = ""
+			}
+		}
+		if fence != "" || i+1 >= len(lines) || !isTableRow(line) || !isTableDelimiter(line, lines[i+1]) {
+			result = append(result, line)
+			continue
+		}
+		end := i + 2
+		for end < len(lines) && isTableRow(lines[end]) {
+			end++
+		}
+		result = append(result, formatTable(lines[i:end])...)
+		i = end - 1
+	}
+	return strings.Join(result, "\n")
+}
+
+func isTableRow(line string) bool {
+	return strings.TrimSpace(line) != "" && strings.Contains(line, "|")
+}
+
+// isTableDelimiter reports whether delimiter is the row separating a
+// table from its header row. A line of dashes alone is not, even after
+// a row with pipes, as that is a setext heading or a thematic break.
+func isTableDelimiter(header, delimiter string) bool {
+	return strings.Contains(delimiter, "|") && tableDelimiterPattern.MatchString(delimiter) &&
+		len(splitTableRow(header)) == len(splitTableRow(delimiter))
+}
+
+// formatTable aligns the table in lines, which holds the header row,
+// the delimiter row, and the body rows, in that order. The header row
+// defines the columns of the table, and shorter rows are padded with
+// empty cells. Rows with more cells than the header have the extra ones
+// ignored when rendered, so tables holding such rows are left untouched
+// rather than showing those cells.
+func formatTable(lines []string) []string {
+	indent := lines[0][:len(lines[0])-len(strings.TrimLeft(lines[0], " \t"))]
+
+	rows := make([][]string, len(lines))
+	for i, line := range lines {
+		rows[i] = splitTableRow(line)
+	}
+	columns := len(rows[0])
+	for _, row := range rows {
+		if len(row) > columns {
+			return lines
+		}
+	}
+
+	align := make([]string, columns)
+	for i, cell := range rows[1] {
+		left := strings.HasPrefix(cell, ":")
+		right := strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			align[i] = "center"
+		case left:
+			align[i] = "left"
+		case right:
+			align[i] = "right"
+		}
+	}
+
+	widths := make([]int, columns)
+	for i := range widths {
+		widths[i] = 3
+	}
+	for i, row := range rows {
+		if i == 1 {
+			continue
+		}
+		for j, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[j] {
+				widths[j] = n
+			}
+		}
+	}
+
+	result := make([]string, len(rows))
+	for i, row := range rows {
+		var buf strings.Builder
+		buf.WriteString(indent)
+		buf.WriteString("|")
+		for j := 0; j < columns; j++ {
+			var cell string
+			if j < len(row) {
+				cell = row[j]
+			}
+			buf.WriteString(" ")
+			if i == 1 {
+				buf.WriteString(delimiterCell(align[j], widths[j]))
+			} else {
+				buf.WriteString(padCell(cell, align[j], widths[j]))
+			}
+			buf.WriteString(" |")
+		}
+		result[i] = buf.String()
+	}
+	return result
+}
+
+// splitTableRow returns the trimmed cells in a table row. Pipes that are
+// escaped or inside code spans do not separate cells.
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var code bool
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '`':
+			code = !code
+		case '|':
+			if !code {
+				cells = append(cells, strings.TrimSpace(line[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(cells, strings.TrimSpace(line[start:]))
+}
+
+func padCell(cell, align string, width int) string {
+	pad := width - utf8.RuneCountInString(cell)
+	switch align {
+	case "right":
+		return strings.Repeat(" ", pad) + cell
+	case "center":
+		return strings.Repeat(" ", pad/2) + cell + strings.Repeat(" ", pad-pad/2)
+	}
+	return cell + strings.Repeat(" ", pad)
+}
+
+func delimiterCell(align string, width int) string {
+	switch align {
+	case "left":
+		return ":" + strings.Repeat("-", width-1)
+	case "right":
+		return strings.Repeat("-", width-1) + ":"
+	case "center":
+		return ":" + strings.Repeat("-", width-2) + ":"
+	}
+	return strings.Repeat("-", width)
+}
+
+// typographyReplacer converts typographic characters commonly introduced
+// by word processors into their plain ASCII counterparts.
+var typographyReplacer = strings.NewReplacer(
+	"‘", "'", "’", "'", "‚", "'", "‛", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`,
+	"—", "--", "–", "-", "…", "...",
+	"\u00a0", " ", "\u202f", " ",
+)
+
+// checkTypographyMode returns an error if mode is not a known -typography mode.
+func checkTypographyMode(mode string) error {
+	switch mode {
+	case "preserve", "code", "all":
+		return nil
+	}
+	return fmt.Errorf("invalid -typography mode %q (must be preserve, code, or all)", mode)
+}
+
+// normalizeTypography replaces smart quotes, dashes, ellipses, and
+// non-breaking spaces in text according to mode. With "preserve" the
+// text is returned unchanged, with "code" only the content of fenced
+// code blocks and inline code spans is converted, and with "all" the
+// whole text is converted.
+func normalizeTypography(text, mode string) string {
+	if mode == "all" {
+		return typographyReplacer.Replace(text)
+	}
+	if mode != "code" {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	var fence string
+	for i, line := range lines {
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			lines[i] = typographyReplacer.Replace(line)
+			if fence == "" {
+				fence = m[1]
+			} else if strings.HasPrefix(m[1], fence) && strings.TrimSpace(line) == m[1] {
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			lines[i] = typographyReplacer.Replace(line)
+			continue
+		}
+		parts := strings.Split(line, "`")
+		for j := 1; j < len(parts)-1; j += 2 {
+			parts[j] = typographyReplacer.Replace(parts[j])
+		}
+		lines[i] = strings.Join(parts, "`")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withoutCode returns text with the content of fenced code blocks and
+// inline code spans replaced by spaces, so that checks on the prose
+// do not trip on code. Line breaks are preserved.
+func withoutCode(text string) string {
+	lines := strings.Split(text, "\n")
+	var fence string
+	blank := func(s string) string {
+		return strings.Repeat(" ", len(s))
+	}
+	for i, line := range lines {
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if strings.HasPrefix(m[1], fence) && strings.TrimSpace(line) == m[1] {
+				fence = ""
+			}
+			lines[i] = blank(line)
+			continue
+		}
+		if fence != "" {
+			lines[i] = blank(line)
+			continue
+		}
+		parts := strings.Split(line, "`")
+		for j := 1; j < len(parts)-1; j += 2 {
+			parts[j] = blank(parts[j])
+		}
+		lines[i] = strings.Join(parts, "`")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestAlignTables(t *testing.T) {
+	tests := []struct {
+		summary string
+		input   string
+		output  string
+	}{{
+		summary: "Alignment markers",
+		input:   "| a | b | c |\n|:-|-:|:-:|\n| xx | y | zzzzz |",
+		output:  "| a   |   b |   c   |\n| :-- | --: | :---: |\n| xx  |   y | zzzzz |",
+	}, {
+		summary: "Escaped pipes",
+		input:   "| a \\| b | c |\n|---|---|\n| 1 | 2 |",
+		output:  "| a \\| b | c   |\n| ------ | --- |\n| 1      | 2   |",
+	}, {
+		summary: "No outer pipes",
+		input:   "a|b\n-|-\nlong cell|x\n\nafter",
+		output:  "| a         | b   |\n| --------- | --- |\n| long cell | x   |\n\nafter",
+	}, {
+		summary: "Fenced code",
+		input:   "```\n| a | b |\n|-|-|\n```",
+		output:  "```\n| a | b |\n|-|-|\n```",
+	}, {
+		summary: "Setext heading with pipes",
+		input:   "a | b\n---",
+		output:  "a | b\n---",
+	}, {
+		summary: "Thematic break after a row",
+		input:   "| a | b |\n\n---",
+		output:  "| a | b |\n\n---",
+	}, {
+		summary: "Delimiter with fewer columns than the header",
+		input:   "a | b | c\n--- | ---\nx | y | z",
+		output:  "a | b | c\n--- | ---\nx | y | z",
+	}, {
+		summary: "Short rows",
+		input:   "| a | b |\n|---|---|\n| x |",
+		output:  "| a   | b   |\n| --- | --- |\n| x   |     |",
+	}, {
+		summary: "Long rows",
+		input:   "| a |\n|---|\n| x | extra |",
+		output:  "| a |\n|---|\n| x | extra |",
+	}, {
+		summary: "Indented table",
+		input:   "  | a | b |\n  |-|-|\n  | x | y |",
+		output:  "  | a   | b   |\n  | --- | --- |\n  | x   | y   |",
+	}, {
+		summary: "Already aligned",
+		input:   "| a   | b   |\n| --- | --- |\n| x   | y   |",
+		output:  "| a   | b   |\n| --- | --- |\n| x   | y   |",
+	}}
+	for _, test := range tests {
+		output := alignTables(test.input)
+		if output != test.output {
+			t.Errorf("%s:\ninput:  %q\noutput: %q\nwant:   %q", test.summary, test.input, output, test.output)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tagCacheAge is how long the tags of a forum are cached.
+const tagCacheAge = time.Hour
+
+// Tags returns the names of all tags in the forum, or nil if they
+// cannot be obtained.
+func (f *Forum) Tags() map[string]bool {
+	key := f.baseURL + " tags"
+	var names []string
+	if !cacheGet(key, tagCacheAge, &names) || names == nil {
+		var result struct {
+			Tags []struct {
+				ID string `json:"id"`
+			} `json:"tags"`
+		}
+		err := f.do("GET", "/tags.json", nil, &result)
+		if err != nil {
+			debugf("Cannot obtain tag list: %v", err)
+			return nil
+		}
+		names = []string{}
+		for _, tag := range result.Tags {
+			names = append(names, strings.ToLower(tag.ID))
+		}
+		sort.Strings(names)
+		err = cacheSet(key, names)
+		if err != nil {
+			debugf("Cannot cache tag list: %v", err)
+		}
+	}
+	tags := make(map[string]bool)
+	for _, name := range names {
+		tags[name] = true
+	}
+	return tags
+}
+
+// categoryHashtags returns the hashtags that refer to categories in
+// site, which take the form "slug" or "parent:slug".
+func categoryHashtags(site *Site) map[string]bool {
+	slugs := make(map[int]string)
+	for _, c := range site.Categories {
+		slugs[c.ID] = strings.ToLower(c.Slug)
+	}
+	hashtags := make(map[string]bool)
+	for _, c := range site.Categories {
+		slug := strings.ToLower(c.Slug)
+		hashtags[slug] = true
+		if parent, ok := slugs[c.ParentCategoryID]; ok {
+			hashtags[parent+":"+slug] = true
+		}
+	}
+	return hashtags
+}
+
+var hashtagPattern = regexp.MustCompile(`(?:^|[\s(\[>])#([\w-]+(?::[\w-]+)?(?:::(?:tag|category))?)`)
+
+// linkDestinationPattern matches the destination of markdown links,
+// which may be in-page anchors such as (#installation) rather than
+// hashtags.
+var linkDestinationPattern = regexp.MustCompile(`\]\([^)]*\)`)
+
+// checkHashtags returns a warning for each distinct #hashtag in text
+// that refers to no category or tag in the forum, as these render
+// as plain text. Numeric hashtags, usually issue references, are
+// ignored.
+func checkHashtags(forum *Forum, text string) []string {
+	var problems []string
+	var categories, tags map[string]bool
+	seen := make(map[string]bool)
+	for _, m := range hashtagPattern.FindAllStringSubmatch(linkDestinationPattern.ReplaceAllString(withoutCode(text), "]"), -1) {
+		hashtag := strings.ToLower(m[1])
+		if seen[hashtag] || numberPattern.MatchString(hashtag) {
+			continue
+		}
+		seen[hashtag] = true
+		if categories == nil {
+			site, err := forum.Site()
+			if err != nil {
+				debugf("Cannot obtain site information: %v", err)
+				return nil
+			}
+			categories = categoryHashtags(site)
+			tags = forum.Tags()
+		}
+		var found bool
+		switch {
+		case strings.HasSuffix(hashtag, "::tag"):
+			found = tags == nil || tags[strings.TrimSuffix(hashtag, "::tag")]
+		case strings.HasSuffix(hashtag, "::category"):
+			found = categories[strings.TrimSuffix(hashtag, "::category")]
+		default:
+			found = categories[hashtag] || tags == nil || tags[hashtag]
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("hashtag #%s matches no category or tag", m[1]))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// The history holds the topics most recently edited, newest first,
+// so that -last may open the latest one again without its URL.
+
+// maxHistory is the number of topics kept in the history.
+const maxHistory = 20
+
+type historyEntry struct {
+	URL   string    `json:"url"`
+	Title string    `json:"title"`
+	Time  time.Time `json:"time"`
+}
+
+func historyPath() string {
+	return configPath + ".history"
+}
+
+func readHistory() ([]*historyEntry, error) {
+	var entries []*historyEntry
+	data, err := ioutil.ReadFile(historyPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read history: %v", err)
+	}
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode history %s: %v", historyPath(), err)
+	}
+	return entries, nil
+}
+
+// recordHistory moves the topic to the top of the history.
+func recordHistory(forum *Forum, topic *Topic) error {
+	unlock, err := lockPath(historyPath())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+	url := topic.ForumURL(forum)
+	if topic.Post.PostNumber > 1 {
+		url = topic.PostURL(forum)
+	}
+	updated := []*historyEntry{{URL: url, Title: topic.Title, Time: time.Now()}}
+	for _, entry := range entries {
+		if entry.URL != url && len(updated) < maxHistory {
+			updated = append(updated, entry)
+		}
+	}
+	data, err := json.MarshalIndent(updated, "", "\t")
+	if err != nil {
+		return fmt.Errorf("internal error: cannot marshal history: %v", err)
+	}
+	err = ioutil.WriteFile(historyPath(), data, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write history: %v", err)
+	}
+	return nil
+}
+
+// lastEditedURL returns the URL of the topic most recently edited.
+func lastEditedURL() (string, error) {
+	unlock, err := lockPath(historyPath())
+	if err != nil {
+		return "", err
+	}
+	entries, err := readHistory()
+	unlock()
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("no topics edited yet")
+	}
+	logf("Reopening %s (%s, last edited %s).", entries[0].URL, entries[0].Title, formatAge(time.Since(entries[0].Time)))
+	return entries[0].URL, nil
+}
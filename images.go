@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var imagePattern = regexp.MustCompile(`<img [^>]*src="([^"]+)"[^>]*>`)
+
+// imageURLs returns the distinct absolute URLs of images shown in the
+// cooked content of a post, leaving out emojis.
+func imageURLs(forum *Forum, cooked string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, m := range imagePattern.FindAllStringSubmatch(cooked, -1) {
+		if strings.Contains(m[0], `class="emoji`) {
+			continue
+		}
+		u := forum.absoluteURL(strings.Replace(m[1], "&amp;", "&", -1))
+		if !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// absoluteURL returns u made absolute relative to the forum. Paths in
+// content rendered by forums installed under a subpath already include
+// the subpath, so they are relative to the forum host only.
+func (f *Forum) absoluteURL(u string) string {
+	switch {
+	case strings.HasPrefix(u, "//"):
+		return "https:" + u
+	case strings.HasPrefix(u, "/"):
+		return f.origin() + u
+	}
+	return u
+}
+
+// origin returns the scheme and host of the forum base URL.
+func (f *Forum) origin() string {
+	if i := strings.Index(f.baseURL, "://"); i >= 0 {
+		if j := strings.Index(f.baseURL[i+3:], "/"); j >= 0 {
+			return f.baseURL[:i+3+j]
+		}
+	}
+	return f.baseURL
+}
+
+// imageSize returns the size in bytes of the image at imageURL, or an
+// error if it cannot be retrieved. The size is taken from a HEAD
+// request when possible, falling back to downloading the image.
+func (f *Forum) imageSize(imageURL string) (int64, error) {
+	for _, verb := range []string{"HEAD", "GET"} {
+		debugf("%s on %s", verb, imageURL)
+		req, err := http.NewRequest(verb, imageURL, nil)
+		if err != nil {
+			return 0, fmt.Errorf("cannot create request: %v", err)
+		}
+		req.Header.Set("User-Agent", f.userAgent())
+		if strings.HasPrefix(imageURL, f.baseURL+"/") {
+			f.authenticate(req)
+			f.wait()
+		}
+		client := httpClient
+		if verb == "GET" {
+			ctx, cancel := transferContext()
+			defer cancel()
+			req = req.WithContext(ctx)
+			client = transferClient
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		size := resp.ContentLength
+		if verb == "GET" && resp.StatusCode == 200 {
+			size, err = io.Copy(ioutil.Discard, resp.Body)
+			stats.Request(size)
+		} else {
+			stats.Request(0)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case resp.StatusCode == 200 && size >= 0:
+			return size, nil
+		case resp.StatusCode == 404 || resp.StatusCode == 410:
+			return 0, fmt.Errorf("got %d status", resp.StatusCode)
+		case verb == "GET":
+			return 0, fmt.Errorf("got %d status", resp.StatusCode)
+		}
+		// Some servers refuse HEAD or omit the length. Try GET.
+	}
+	panic("unreachable")
+}
+
+// auditImages returns a description of each image in post that is
+// missing or larger than -max-image-size.
+func auditImages(forum *Forum, post *Post) []string {
+	var problems []string
+	for _, u := range imageURLs(forum, post.Cooked) {
+		size, err := forum.imageSize(u)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("broken image %s: %v", u, err))
+		} else if *maxImageSize > 0 && size > int64(*maxImageSize)*1024 {
+			problems = append(problems, fmt.Sprintf("oversized image %s: %s", u, formatSize(size)))
+		}
+	}
+	return problems
+}
+
+func runAuditImages(config *Config, args []string) error {
+	var forum *Forum
+	var topics []*Topic
+	if len(args) == 1 && !categoryURLPattern.MatchString(config.expandAlias(args[0])) && *category == "" {
+		var topicID int
+		var err error
+		forum, topicID, err = openTopic(config, args[0])
+		if err != nil {
+			return err
+		}
+		topics = []*Topic{{ID: topicID}}
+	} else {
+		var categoryPath string
+		var err error
+		forum, categoryPath, err = openCategory(config, args)
+		if err != nil {
+			return err
+		}
+		topics, err = forum.LoadCategoryTopics(categoryPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var count int
+	progress := newProgress(len(topics))
+	for _, t := range topics {
+		name := t.Title
+		if name == "" {
+			name = fmt.Sprintf("topic %d", t.ID)
+		}
+		progress.Start(name)
+		topic, err := forum.LoadTopic(t.ID)
+		if err != nil {
+			progress.Failed(err)
+			continue
+		}
+		problems := auditImages(forum, topic.Post)
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", topic.ForumURL(forum), problem)
+		}
+		count += len(problems)
+		progress.Succeeded()
+	}
+	err := progress.Summary()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("found %d image problem(s)", count)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// importedMessage is an email message to be imported into the forum.
+type importedMessage struct {
+	ID        string
+	InReplyTo string
+	From      *mail.Address
+	Subject   string
+	Date      time.Time
+	Body      string
+}
+
+// runImport imports an email thread, from mbox or eml files, as a new
+// topic in the category given with -category, with a reply for every
+// message after the first one.
+func runImport(config *Config, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("import command expects a forum URL and mbox or eml files")
+	}
+	if *category == "" {
+		return fmt.Errorf("import command requires the -category option")
+	}
+	baseURL, err := parseForumURL(config.expandAlias(args[0]))
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, baseURL)
+	if err != nil {
+		return err
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+	site, err := forum.Site()
+	if err != nil {
+		return fmt.Errorf("cannot find category: %v", err)
+	}
+	c := site.CategoryByPath(*category)
+	if c == nil {
+		return fmt.Errorf("category %s does not exist or is not visible to the configured user", *category)
+	}
+
+	var messages []*importedMessage
+	for _, filename := range args[1:] {
+		fileMessages, err := readMessages(filename)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, fileMessages...)
+	}
+	if len(messages) == 0 {
+		return fmt.Errorf("no messages found to import")
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Date.Before(messages[j].Date)
+	})
+
+	stats.Phase("import")
+	title := threadTitle(messages[0].Subject)
+	progress := newProgress(len(messages))
+	postNumbers := make(map[string]int)
+	var topicID int
+	for i, msg := range messages {
+		progress.Start(fmt.Sprintf("Message from %s on %s", msg.From.Address, msg.Date.Format("2006-01-02 15:04")))
+		params := map[string]interface{}{
+			"created_at": msg.Date.UTC().Format(time.RFC3339),
+		}
+		if i == 0 {
+			params["title"] = title
+			params["category"] = c.ID
+		} else {
+			params["topic_id"] = topicID
+			if n, ok := postNumbers[msg.InReplyTo]; ok && n > 1 {
+				params["reply_to_post_number"] = n
+			}
+		}
+		post, err := forum.importMessage(msg, params)
+		if err != nil {
+			progress.Failed(err)
+			if i == 0 {
+				return progress.Summary()
+			}
+			continue
+		}
+		if post != nil {
+			topicID = post.TopicID
+			postNumbers[msg.ID] = post.PostNumber
+		}
+		progress.Succeeded()
+	}
+	if topicID != 0 {
+		logf("Imported thread: %s/t/%d", forum.baseURL, topicID)
+	}
+	return progress.Summary()
+}
+
+// importMessage posts msg to the forum with the given parameters. If
+// the sender's address is mapped to a username with import_users, the
+// post is made as that user, which requires an admin API key. Otherwise
+// it is made as the configured user, with a line crediting the sender.
+func (f *Forum) importMessage(msg *importedMessage, params map[string]interface{}) (*Post, error) {
+	poster := f
+	var username string
+	for address, name := range f.config.ImportUsers {
+		if strings.EqualFold(address, msg.From.Address) {
+			username = name
+		}
+	}
+	if username != "" && f.config.UserAPIKey != "" {
+		debugf("Cannot post as %s with a user API key.", username)
+		username = ""
+	}
+	if username != "" {
+		config := *f.config
+		config.Username = username
+		as := *f
+		as.config = &config
+		poster = &as
+		params["raw"] = msg.Body
+	} else {
+		name := msg.From.Name
+		if name == "" {
+			name = msg.From.Address
+		}
+		params["raw"] = fmt.Sprintf("*%s wrote on %s:*\n\n%s", name, msg.Date.UTC().Format("2006-01-02 15:04 MST"), msg.Body)
+	}
+
+	if *dryRun {
+		if username == "" {
+			username = f.config.Username
+		}
+		logf("Dry run: not posting as %s. Content would be:", username)
+		showDiff("", fmt.Sprint(params["raw"]))
+		return nil, nil
+	}
+	return poster.CreatePost(params)
+}
+
+var subjectPrefix = regexp.MustCompile(`^(?i)((re|fwd?|aw)\s*:\s*|\[[^\]]*\]\s*)+`)
+
+// threadTitle returns the title of the topic for a thread with the given
+// subject, dropping reply markers and mailing list tags.
+func threadTitle(subject string) string {
+	title := strings.TrimSpace(subjectPrefix.ReplaceAllString(subject, ""))
+	if title == "" {
+		return "Imported thread"
+	}
+	return title
+}
+
+// readMessages reads the messages in the named mbox or eml file.
+// Files starting with an mbox "From " line are split into messages.
+func readMessages(filename string) ([]*importedMessage, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read messages: %v", err)
+	}
+	var raws [][]byte
+	if bytes.HasPrefix(data, []byte("From ")) {
+		raws = splitMbox(data)
+	} else {
+		raws = [][]byte{data}
+	}
+	var messages []*importedMessage
+	for i, raw := range raws {
+		msg, err := parseMessage(raw)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse message %d in %s: %v", i+1, filename, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// splitMbox splits the content of an mbox file into the raw messages
+// it holds, undoing the quoting of lines starting with "From ".
+func splitMbox(data []byte) [][]byte {
+	var raws [][]byte
+	var current []byte
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("From ")) {
+			if current != nil {
+				raws = append(raws, current)
+			}
+			current = []byte{}
+			continue
+		}
+		if mboxQuotedFrom.Match(line) {
+			line = line[1:]
+		}
+		current = append(current, line...)
+	}
+	if current != nil {
+		raws = append(raws, current)
+	}
+	return raws
+}
+
+var mboxQuotedFrom = regexp.MustCompile(`^>+From `)
+
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		data, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		text, err := decodeCharset(charset, data)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(text), nil
+	},
+}
+
+func parseMessage(raw []byte) (*importedMessage, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddress(m.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %v", err)
+	}
+	date, err := m.Header.Date()
+	if err != nil {
+		return nil, fmt.Errorf("invalid date: %v", err)
+	}
+	subject, err := wordDecoder.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		subject = m.Header.Get("Subject")
+	}
+	body, err := messageText(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &importedMessage{
+		ID:        strings.TrimSpace(m.Header.Get("Message-Id")),
+		InReplyTo: strings.TrimSpace(m.Header.Get("In-Reply-To")),
+		From:      from,
+		Subject:   subject,
+		Date:      date,
+		Body:      strings.TrimSpace(strings.Replace(body, "\r\n", "\n", -1)),
+	}, nil
+}
+
+// messageText returns the plain text of a message body with the given
+// content type and transfer encoding, converted to UTF-8 from the charset
+// in the content type. For multipart messages the first plain text part
+// is used.
+func messageText(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if contentType == "" || err != nil {
+		mediaType = "text/plain"
+	}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		partErr := fmt.Errorf("message has no plain text content")
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return "", partErr
+			}
+			if err != nil {
+				return "", fmt.Errorf("cannot read message part: %v", err)
+			}
+			text, err := messageText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err == nil {
+				return text, nil
+			}
+			if _, ok := err.(*charsetError); ok {
+				partErr = err
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", fmt.Errorf("message has no plain text content")
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", fmt.Errorf("cannot read message content: %v", err)
+	}
+	return decodeCharset(params["charset"], data)
+}
+
+// charsetError reports message content that cannot be converted to UTF-8.
+type charsetError struct {
+	msg string
+}
+
+func (e *charsetError) Error() string { return e.msg }
+
+// decodeCharset returns data converted to UTF-8 from the given charset.
+// Besides UTF-8 and US-ASCII only ISO-8859-1 and Windows-1252 are known.
+// As in web browsers, ISO-8859-1 is decoded as Windows-1252, which it is
+// commonly mislabeled for.
+func decodeCharset(charset string, data []byte) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		if !utf8.Valid(data) {
+			return "", &charsetError{"message content is not valid UTF-8"}
+		}
+		return string(data), nil
+	case "iso-8859-1", "iso8859-1", "latin1", "windows-1252", "cp1252":
+		var buf strings.Builder
+		for _, b := range data {
+			if b >= 0x80 && b < 0xa0 && windows1252[b-0x80] != 0 {
+				buf.WriteRune(windows1252[b-0x80])
+			} else {
+				buf.WriteRune(rune(b))
+			}
+		}
+		return buf.String(), nil
+	}
+	return "", &charsetError{fmt.Sprintf("message content has unsupported charset %q", charset)}
+}
+
+// windows1252 holds the characters for bytes 0x80 to 0x9f in Windows-1252.
+// Bytes with no character assigned are zero, and map to the same code point.
+var windows1252 = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMbox(t *testing.T) {
+	// Unquoted "From " lines in a body start a new message, as in mboxrd.
+	data := "From joe@example.com Mon Jan  2 15:04:05 2006\n" +
+		"Subject: One\n\nFirst body.\n>From here on\n>>From quoted twice\n\n" +
+		"From ann@example.com Mon Jan  2 16:04:05 2006\n" +
+		"Subject: Two\n\nFrom the start of a line.\n"
+	raws := splitMbox([]byte(data))
+	want := []string{
+		"Subject: One\n\nFirst body.\nFrom here on\n>From quoted twice\n\n",
+		"Subject: Two\n\n",
+		"",
+	}
+	if len(raws) != len(want) {
+		t.Fatalf("got %d messages, want %d: %q", len(raws), len(want), raws)
+	}
+	for i, w := range want {
+		if string(raws[i]) != w {
+			t.Errorf("message %d:\ngot  %q\nwant %q", i+1, raws[i], w)
+		}
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	header := "From: Joe <joe@example.com>\nDate: Mon, 2 Jan 2006 15:04:05 -0700\nMessage-Id: <1@example.com>\n"
+	tests := []struct {
+		summary string
+		message string
+		subject string
+		body    string
+		err     string
+	}{{
+		summary: "Plain text",
+		message: header + "Subject: Hello\n\nHello there.\n",
+		subject: "Hello",
+		body:    "Hello there.",
+	}, {
+		summary: "Quoted-printable",
+		message: header + "Subject: =?UTF-8?Q?Ol=C3=A1?=\nContent-Type: text/plain; charset=utf-8\n" +
+			"Content-Transfer-Encoding: quoted-printable\n\nOl=C3=A1, a long =\nline.\n",
+		subject: "Olá",
+		body:    "Olá, a long line.",
+	}, {
+		summary: "Base64",
+		message: header + "Subject: Hi\nContent-Transfer-Encoding: base64\n\nSGVsbG8g\nd29ybGQu\n",
+		subject: "Hi",
+		body:    "Hello world.",
+	}, {
+		summary: "Multipart alternative",
+		message: header + "Subject: Hi\nContent-Type: multipart/alternative; boundary=b\n\n" +
+			"--b\nContent-Type: text/html\n\n<p>Rich</p>\n" +
+			"--b\nContent-Type: text/plain; charset=utf-8\nContent-Transfer-Encoding: quoted-printable\n\nPlain =E2=9C=93\n" +
+			"--b--\n",
+		subject: "Hi",
+		body:    "Plain ✓",
+	}, {
+		summary: "Multipart without plain text",
+		message: header + "Subject: Hi\nContent-Type: multipart/alternative; boundary=b\n\n" +
+			"--b\nContent-Type: text/html\n\n<p>Rich</p>\n--b--\n",
+		err: "message has no plain text content",
+	}, {
+		summary: "ISO-8859-1",
+		message: header + "Subject: =?ISO-8859-1?Q?Ol=E1?=\nContent-Type: text/plain; charset=ISO-8859-1\n" +
+			"Content-Transfer-Encoding: quoted-printable\n\nOl=E1 =93mundo=94\n",
+		subject: "Olá",
+		body:    "Olá “mundo”",
+	}, {
+		summary: "Windows-1252 subject",
+		message: header + "Subject: =?windows-1252?Q?=80_5?=\n\nCheap.\n",
+		subject: "€ 5",
+		body:    "Cheap.",
+	}, {
+		summary: "Unsupported charset",
+		message: header + "Subject: Hi\nContent-Type: text/plain; charset=koi8-r\n\n\xf0\xd2\xc9\xd7\xc5\xd4\n",
+		err:     `message content has unsupported charset "koi8-r"`,
+	}, {
+		summary: "Unsupported charset in multipart",
+		message: header + "Subject: Hi\nContent-Type: multipart/alternative; boundary=b\n\n" +
+			"--b\nContent-Type: text/plain; charset=koi8-r\n\n\xf0\xd2\xc9\xd7\xc5\xd4\n--b--\n",
+		err: `message content has unsupported charset "koi8-r"`,
+	}, {
+		summary: "Invalid UTF-8",
+		message: header + "Subject: Hi\n\nOl\xe1\n",
+		err:     "message content is not valid UTF-8",
+	}}
+
+	for _, test := range tests {
+		msg, err := parseMessage([]byte(test.message))
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s:\ngot error %v, want %q", test.summary, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s:\nunexpected error: %v", test.summary, err)
+			continue
+		}
+		if msg.Subject != test.subject || msg.Body != test.body {
+			t.Errorf("%s:\ngot subject %q and body %q\nwant subject %q and body %q",
+				test.summary, msg.Subject, msg.Body, test.subject, test.body)
+		}
+		if msg.From.Address != "joe@example.com" || msg.ID != "<1@example.com>" || !strings.HasPrefix(msg.Date.String(), "2006-01-02 15:04:05") {
+			t.Errorf("%s:\nunexpected headers: %v %q %v", test.summary, msg.From, msg.ID, msg.Date)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/niemeyer/discedit/discourse"
+	"github.com/niemeyer/discedit/discoursetest"
+)
+
+// newTestForum returns a forum backed by a fake Discourse server, with
+// the local configuration and cache kept in a temporary directory.
+func newTestForum(t *testing.T) (*discoursetest.Server, *Forum) {
+	srv := discoursetest.NewServer()
+	t.Cleanup(srv.Close)
+
+	oldConfigPath := configPath
+	configPath = filepath.Join(t.TempDir(), "discedit")
+	t.Cleanup(func() { configPath = oldConfigPath })
+
+	oldConflict := *conflict
+	t.Cleanup(func() { *conflict = oldConflict })
+
+	forum := &Forum{
+		config:  &ForumConfig{Username: "tester", Key: "secret"},
+		baseURL: srv.URL,
+	}
+	return srv, forum
+}
+
+// writeTestFile writes content to a file in a temporary directory
+// and returns its path.
+func writeTestFile(t *testing.T, content string) string {
+	filename := filepath.Join(t.TempDir(), "topic.md")
+	err := ioutil.WriteFile(filename, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestIntegrationSaveTopic(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "One.\n\nTwo.")
+
+	topic, err := forum.LoadTopic(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic.Title != "Some topic" || topic.Post.Raw != "One.\n\nTwo." {
+		t.Fatalf("loaded wrong topic: %q with %q", topic.Title, topic.Post.Raw)
+	}
+
+	err = forum.SaveTopic(topic, writeTestFile(t, "One.\n\nTwo!\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	postID := created.Posts[0].ID
+	if raw := srv.Raw(postID); raw != "One.\n\nTwo!" {
+		t.Fatalf("forum holds %q after save", raw)
+	}
+	if version := srv.Version(postID); version != 2 {
+		t.Fatalf("post version is %d after save, want 2", version)
+	}
+	if topic.Post.Raw != "One.\n\nTwo!" {
+		t.Fatalf("topic holds %q after save", topic.Post.Raw)
+	}
+}
+
+func TestIntegrationConflictMerge(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "One.\n\nTwo.\n\nThree.")
+	postID := created.Posts[0].ID
+	*conflict = "merge"
+
+	topic, err := forum.LoadTopic(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Edit(postID, "One!\n\nTwo.\n\nThree.")
+
+	err = forum.SaveTopic(topic, writeTestFile(t, "One.\n\nTwo.\n\nThree!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw := srv.Raw(postID); raw != "One!\n\nTwo.\n\nThree!" {
+		t.Fatalf("forum holds %q after merge", raw)
+	}
+}
+
+func TestIntegrationConflictOverlapping(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "One.")
+	postID := created.Posts[0].ID
+	*conflict = "merge"
+
+	topic, err := forum.LoadTopic(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Edit(postID, "One?")
+
+	err = forum.SaveTopic(topic, writeTestFile(t, "One!"))
+	if !isConflict(err) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if raw := srv.Raw(postID); raw != "One?" {
+		t.Fatalf("forum holds %q after failed merge", raw)
+	}
+}
+
+func TestIntegrationConflictAbort(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "One.\n\nTwo.")
+	postID := created.Posts[0].ID
+	*conflict = "abort"
+
+	topic, err := forum.LoadTopic(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Edit(postID, "One!\n\nTwo.")
+
+	err = forum.SaveTopic(topic, writeTestFile(t, "One.\n\nTwo!"))
+	if !isConflict(err) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if raw := srv.Raw(postID); raw != "One!\n\nTwo." {
+		t.Fatalf("forum holds %q after aborted save", raw)
+	}
+}
+
+func TestIntegrationSaveReply(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "First.")
+	reply := srv.AddPost(created.ID, "someone", "Reply.")
+
+	topic, err := forum.LoadTopicPost(created.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic.Post.ID != reply.ID || topic.Post.Raw != "Reply." {
+		t.Fatalf("loaded wrong post: %d with %q", topic.Post.ID, topic.Post.Raw)
+	}
+
+	err = forum.SaveDraft(topic, writeTestFile(t, "Reply, in progress."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.Draft(fmt.Sprintf("topic_%d_post_%d", created.ID, reply.ID)) == "" {
+		t.Fatalf("forum has no draft for the reply under key %q", topic.Draft.Key)
+	}
+	if srv.Draft(fmt.Sprintf("topic_%d", created.ID)) != "" {
+		t.Fatal("draft for the reply stored as the topic's")
+	}
+
+	err = forum.SaveTopic(topic, writeTestFile(t, "Reply!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw := srv.Raw(reply.ID); raw != "Reply!" {
+		t.Fatalf("forum holds %q for the reply", raw)
+	}
+	if raw := srv.Raw(created.Posts[0].ID); raw != "First." {
+		t.Fatalf("forum holds %q for the first post", raw)
+	}
+}
+
+func TestIntegrationDraft(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "One.")
+
+	topic, err := forum.LoadTopic(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = forum.SaveDraft(topic, writeTestFile(t, "One, in progress."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.Draft(topic.Draft.Key) == "" {
+		t.Fatalf("forum has no draft under key %q", topic.Draft.Key)
+	}
+
+	reloaded, err := forum.LoadTopic(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = forum.LoadDraft(reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Draft == nil {
+		t.Fatal("draft not loaded")
+	}
+	if reloaded.Draft.Data.Reply != "One, in progress." || reloaded.Draft.Data.OriginalText != "One." {
+		t.Fatalf("loaded wrong draft: %#v", reloaded.Draft.Data)
+	}
+	if reloaded.DraftSequence != 1 {
+		t.Fatalf("draft sequence is %d, want 1", reloaded.DraftSequence)
+	}
+
+	// Saving with an outdated sequence conflicts with the other session.
+	err = forum.SaveDraft(topic, writeTestFile(t, "One, in progress."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic.DraftSequence = 0
+	err = forum.SaveDraft(topic, writeTestFile(t, "One, elsewhere."))
+	if !isConflict(err) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+}
+
+func TestIntegrationRateLimited(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "One.")
+	srv.RateLimit(30)
+
+	_, err := forum.LoadTopic(created.ID)
+	var limited *discourse.RateLimitedError
+	if !errors.As(err, &limited) {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+	if limited.Wait != 30*time.Second {
+		t.Fatalf("rate limit asks to wait %v, want 30s", limited.Wait)
+	}
+
+	_, err = forum.LoadTopic(created.ID)
+	if err != nil {
+		t.Fatalf("rate limit did not go away: %v", err)
+	}
+}
+
+func TestIntegrationNotFound(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "One.")
+
+	_, err := forum.LoadTopic(created.ID + 100)
+	if !isNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	_, err = forum.LoadPost(created.Posts[0].ID + 100)
+	if !isNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestIntegrationUnauthorized(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "One.")
+
+	srv.Fail(401)
+	_, err := forum.LoadTopic(created.ID)
+	if !isUnauthorized(err) || isNotFound(err) {
+		t.Fatalf("expected unauthorized error, got %v", err)
+	}
+}
+
+func TestIntegrationReplyDraft(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "One.")
+
+	topic, err := forum.LoadTopic(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draft, err := forum.loadReplyDraft(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if draft.Key != fmt.Sprintf("topic_%d", topic.ID) {
+		t.Fatalf("reply draft key is %q", draft.Key)
+	}
+	err = forum.saveReplyDraft(topic, draft, writeTestFile(t, "A reply."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The reply draft is not taken as a draft editing the topic.
+	err = forum.LoadDraft(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic.Draft != nil {
+		t.Fatalf("reply draft loaded for editing: %#v", topic.Draft.Data)
+	}
+
+	reloaded, err := forum.loadReplyDraft(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Data == nil || reloaded.Data.Reply != "A reply." {
+		t.Fatalf("loaded wrong reply draft: %#v", reloaded.Data)
+	}
+
+	_, err = forum.CreatePost(map[string]interface{}{
+		"topic_id":  topic.ID,
+		"raw":       "A reply.",
+		"draft_key": reloaded.Key,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.Draft(reloaded.Key) != "" {
+		t.Fatal("reply draft left behind after posting")
+	}
+}
+
+func TestIntegrationMirrorRemoteChange(t *testing.T) {
+	srv, forum := newTestForum(t)
+	created := srv.AddTopic("Some topic", "One.")
+	postID := created.Posts[0].ID
+
+	mirror := &Mirror{}
+	mtopic := &MirrorTopic{TopicID: created.ID, PostID: postID, Version: 1}
+
+	changed, deleted, err := mirror.RemoteChange(forum, mtopic)
+	if err != nil || changed || deleted {
+		t.Fatalf("unchanged post reported as changed=%v deleted=%v err=%v", changed, deleted, err)
+	}
+	if mtopic.ETag == "" {
+		t.Fatalf("ETag of unchanged post was not recorded")
+	}
+
+	changed, _, err = mirror.RemoteChange(forum, mtopic)
+	if err != nil || changed {
+		t.Fatalf("unchanged post reported as changed=%v err=%v", changed, err)
+	}
+	if srv.NotModified() != 1 {
+		t.Fatalf("post was transferred again rather than checked with its ETag")
+	}
+
+	etag := mtopic.ETag
+	srv.Edit(postID, "Two.")
+	changed, _, err = mirror.RemoteChange(forum, mtopic)
+	if err != nil || !changed {
+		t.Fatalf("edited post reported as changed=%v err=%v", changed, err)
+	}
+	if mtopic.ETag != etag {
+		t.Fatalf("ETag of edited post was recorded for the mirrored version")
+	}
+
+	mtopic.PostID += 100
+	_, deleted, err = mirror.RemoteChange(forum, mtopic)
+	if err != nil || !deleted {
+		t.Fatalf("missing post reported as deleted=%v err=%v", deleted, err)
+	}
+}
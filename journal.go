@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The session journal records what happened during each editing
+// session, such as draft and live saves, conflicts, and the final
+// result, so that a botched edit can be reconstructed later.
+
+func journalPath() string {
+	return configPath + ".sessions"
+}
+
+// maxJournalSize is the size in bytes past which the journal is moved
+// aside to start over, replacing the one moved aside before it, so at
+// most about twice that is kept.
+const maxJournalSize = 1024 * 1024
+
+type journalEntry struct {
+	Time    time.Time `json:"time"`
+	Session string    `json:"session"`
+	Topic   string    `json:"topic,omitempty"`
+	Event   string    `json:"event"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+type sessionJournal struct {
+	mu      sync.Mutex
+	session string
+	topic   string
+}
+
+var journal = &sessionJournal{}
+
+// Start begins a new session editing topic.
+func (j *sessionJournal) Start(forum *Forum, topic *Topic) {
+	j.mu.Lock()
+	j.session = fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), os.Getpid())
+	j.topic = topic.ForumURL(forum)
+	j.mu.Unlock()
+	if *dryRun {
+		j.Record("start", "dry run")
+	} else {
+		j.Record("start", "")
+	}
+}
+
+// End finishes the current session with the given result.
+func (j *sessionJournal) End(err error) {
+	if err != nil {
+		j.Record("end", "error: "+err.Error())
+	} else {
+		j.Record("end", "ok")
+	}
+	j.mu.Lock()
+	j.session = ""
+	j.mu.Unlock()
+}
+
+// Record appends an event to the journal if a session is active.
+// Failing to record events does not interrupt the session.
+func (j *sessionJournal) Record(event, detail string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.session == "" {
+		return
+	}
+	data, err := json.Marshal(&journalEntry{
+		Time:    time.Now(),
+		Session: j.session,
+		Topic:   j.topic,
+		Event:   event,
+		Detail:  detail,
+	})
+	if err != nil {
+		debugf("Cannot marshal journal entry: %v", err)
+		return
+	}
+	unlock, err := lockPath(journalPath())
+	if err != nil {
+		debugf("Cannot lock session journal: %v", err)
+		return
+	}
+	defer unlock()
+	if info, err := os.Stat(journalPath()); err == nil && info.Size() > maxJournalSize {
+		err = os.Rename(journalPath(), journalPath()+".old")
+		if err != nil {
+			debugf("Cannot rotate session journal: %v", err)
+		}
+	}
+	f, err := os.OpenFile(journalPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		debugf("Cannot open session journal: %v", err)
+		return
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		debugf("Cannot write session journal: %v", err)
+	}
+}
+
+// readJournal returns the entries in the journal, including those in
+// the journal moved aside last, oldest first.
+func readJournal() ([]*journalEntry, error) {
+	unlock, err := lockPath(journalPath())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	old, err := readJournalFile(journalPath() + ".old")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readJournalFile(journalPath())
+	if err != nil {
+		return nil, err
+	}
+	return append(old, entries...), nil
+}
+
+func readJournalFile(path string) ([]*journalEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read session journal: %v", err)
+	}
+	defer f.Close()
+	var entries []*journalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, &entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read session journal: %v", err)
+	}
+	return entries, nil
+}
+
+// recentSessions is how many sessions the sessions command lists.
+const recentSessions = 20
+
+// runSessions lists recent editing sessions, or the events of a
+// single session when its ID is provided.
+func runSessions(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("sessions command expects at most one session ID")
+	}
+	entries, err := readJournal()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		found := false
+		for _, entry := range entries {
+			if entry.Session != args[0] {
+				continue
+			}
+			if !found {
+				fmt.Printf("Session %s on %s\n", entry.Session, entry.Topic)
+				found = true
+			}
+			line := fmt.Sprintf("%s  %-12s %s", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Event, entry.Detail)
+			fmt.Println(strings.TrimSpace(line))
+		}
+		if !found {
+			return fmt.Errorf("session %s not found in %s", args[0], journalPath())
+		}
+		return nil
+	}
+
+	type summary struct {
+		first, last *journalEntry
+		events      int
+	}
+	var order []string
+	sessions := make(map[string]*summary)
+	for _, entry := range entries {
+		s, ok := sessions[entry.Session]
+		if !ok {
+			s = &summary{first: entry}
+			sessions[entry.Session] = s
+			order = append(order, entry.Session)
+		}
+		s.last = entry
+		s.events++
+	}
+	if len(order) > recentSessions {
+		order = order[len(order)-recentSessions:]
+	}
+	for _, id := range order {
+		s := sessions[id]
+		result := "unfinished"
+		if s.last.Event == "end" {
+			result = s.last.Detail
+		}
+		duration := s.last.Time.Sub(s.first.Time).Round(time.Second)
+		fmt.Printf("%s  %-8s %3d events  %s  %s\n", id, duration, s.events, s.first.Topic, result)
+	}
+	return nil
+}
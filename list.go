@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// runList lists the topics in a category and lets the user pick
+// them for editing.
+func runList(config *Config, args []string) error {
+	forum, categoryPath, err := openCategory(config, args)
+	if err != nil {
+		return err
+	}
+	err = checkCategoryAccess(forum, categoryPath)
+	if err != nil {
+		return err
+	}
+	topics, err := forum.LoadCategoryTopics(categoryPath)
+	if err != nil {
+		return err
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("category %s has no topics", categoryPath)
+	}
+	return pickTopics(forum, topics)
+}
+
+// pickTopics lists topics and lets the user pick them for editing
+// one after the other.
+func pickTopics(forum *Forum, topics []*Topic) error {
+	for {
+		printTopics(forum, topics)
+		answer, err := readLine("Topic to edit (empty to quit): ")
+		if err != nil || answer == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 || n > len(topics) {
+			logf("Please pick a topic number between 1 and %d.", len(topics))
+			continue
+		}
+		err = editTopic(forum, topics[n-1].ID, 1)
+		if err != nil {
+			logf("Cannot edit %s: %v", topics[n-1], err)
+		}
+	}
+}
+
+// openCategory returns the forum and category path referenced by args,
+// which hold either a category URL, or a forum URL when the category
+// slug is provided via the -category option.
+func openCategory(config *Config, args []string) (forum *Forum, categoryPath string, err error) {
+	if len(args) != 1 {
+		return nil, "", fmt.Errorf("command expects a single forum or category URL")
+	}
+	var baseURL string
+	arg := config.expandAlias(args[0])
+	if categoryURLPattern.MatchString(arg) {
+		baseURL, categoryPath, err = parseCategoryURL(arg)
+	} else {
+		baseURL, err = parseForumURL(arg)
+		categoryPath = strings.Trim(*category, "/")
+		if err == nil && categoryPath == "" {
+			err = fmt.Errorf("command requires a category URL or the -category option")
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	forum, err = openForum(config, baseURL)
+	if err != nil {
+		return nil, "", err
+	}
+	return forum, categoryPath, nil
+}
+
+// printTopics prints a numbered list of topics, marking those in
+// categories the configured user can only read.
+func printTopics(forum *Forum, topics []*Topic) {
+	site, err := forum.Site()
+	if err != nil {
+		debugf("Cannot obtain site information: %v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, topic := range topics {
+		var note string
+		if site != nil {
+			if c := site.Category(topic.Category); c != nil && c.ReadOnly() {
+				note = " (read-only)"
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s%s\n", i+1, topic.LastUpdate().Local().Format("2006-01-02 15:04"), topic.Title, note)
+	}
+	w.Flush()
+}
+
+// LoadCategoryTopics returns all topics in the category at the given path.
+func (f *Forum) LoadCategoryTopics(categoryPath string) ([]*Topic, error) {
+
+	logf("Loading topics in category %s...", categoryPath)
+
+	var topics []*Topic
+	for page := 0; ; page++ {
+		var result struct {
+			TopicList struct {
+				Topics        []*Topic `json:"topics"`
+				MoreTopicsURL string   `json:"more_topics_url"`
+			} `json:"topic_list"`
+		}
+		err := f.do("GET", "/c/"+categoryPath+"/l/latest.json?page="+strconv.Itoa(page), nil, &result)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, result.TopicList.Topics...)
+		if len(result.TopicList.Topics) == 0 || result.TopicList.MoreTopicsURL == "" {
+			break
+		}
+	}
+	return topics, nil
+}
+
+// runLatest lists the latest topics in the forum, or in a category with
+// the -category option. When running in a terminal the user may pick
+// topics for editing, and otherwise their URLs and titles are printed.
+func runLatest(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("latest command expects a single forum URL")
+	}
+	baseURL, err := parseForumURL(config.expandAlias(args[0]))
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, baseURL)
+	if err != nil {
+		return err
+	}
+	categoryPath := strings.Trim(*category, "/")
+	topics, err := forum.LoadLatestTopics(categoryPath)
+	if err != nil {
+		return err
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("no topics found")
+	}
+	if isTerminal(os.Stdin) && isTerminal(os.Stdout) {
+		return pickTopics(forum, topics)
+	}
+	for _, topic := range topics {
+		fmt.Printf("%s\t%s\n", topic.ForumURL(forum), topic.Title)
+	}
+	return nil
+}
+
+// LoadLatestTopics returns the first page of the latest topics in the
+// forum, or in the category at categoryPath if not empty.
+func (f *Forum) LoadLatestTopics(categoryPath string) ([]*Topic, error) {
+	path := "/latest.json"
+	if categoryPath != "" {
+		path = "/c/" + categoryPath + "/l/latest.json"
+	}
+
+	logf("Loading latest topics...")
+
+	var result struct {
+		TopicList struct {
+			Topics []*Topic `json:"topics"`
+		} `json:"topic_list"`
+	}
+	err := f.do("GET", path, nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.TopicList.Topics, nil
+}
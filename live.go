@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Every live save creates a revision of the post, which may quickly
+// clutter its edit history. With -live-interval and -live-min-change,
+// saves that come too soon after the last live save, or that change
+// too little, are kept in the draft instead, and published along with
+// later changes or when the editor is closed.
+
+// liveSaveDue reports whether the content in filename should be saved
+// live into the post, given when it was last saved live and what the
+// post holds now. When it should not, the reason is returned.
+func liveSaveDue(filename string, lastSave time.Time, published string) (due bool, reason string) {
+	if *liveInterval > 0 && !lastSave.IsZero() && time.Since(lastSave) < *liveInterval {
+		return false, fmt.Sprintf("last live save was less than %v ago", *liveInterval)
+	}
+	if *liveMinChange > 0 {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return false, err.Error()
+		}
+		added, removed := diffStat(published, storedText(string(data)))
+		if added+removed < *liveMinChange {
+			return false, fmt.Sprintf("only %d line(s) changed since the last live save", added+removed)
+		}
+	}
+	return true, ""
+}
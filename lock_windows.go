@@ -0,0 +1,11 @@
+package main
+
+// lockPath is a no-op on Windows, where flock is unavailable.
+func lockPath(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
+
+// tryLockPath is a no-op on Windows, where flock is unavailable.
+func tryLockPath(path string) (unlock func(), ok bool, err error) {
+	return func() {}, true, nil
+}
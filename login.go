@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// runLogin obtains a User API Key for the forum via its login flow,
+// for forums that do not hand out admin API keys.
+func runLogin(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("login command expects a single forum URL")
+	}
+	baseURL, err := parseForumURL(args[0])
+	if err != nil {
+		return err
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("cannot generate key pair: %v", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return fmt.Errorf("cannot marshal public key: %v", err)
+	}
+	clientID, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{
+		"application_name": {"discedit"},
+		"client_id":        {clientID},
+		"scopes":           {"read,write"},
+		"nonce":            {nonce},
+		"public_key":       {string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))},
+	}
+	fmt.Printf("Open the following URL in your browser and authorize discedit:\n\n%s/user-api-key/new?%s\n\n", baseURL, query.Encode())
+
+	payload, err := readLine("Then paste the text displayed by the forum here: ")
+	if err != nil {
+		return fmt.Errorf("cannot read authorization payload: %v", err)
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+	if err != nil {
+		return fmt.Errorf("cannot decode authorization payload: %v", err)
+	}
+	decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, encrypted)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt authorization payload: %v", err)
+	}
+	var result struct {
+		Key   string `json:"key"`
+		Nonce string `json:"nonce"`
+	}
+	err = json.Unmarshal(decrypted, &result)
+	if err != nil {
+		return fmt.Errorf("cannot decode authorization payload: %v", err)
+	}
+	if result.Nonce != nonce || result.Key == "" {
+		return fmt.Errorf("authorization payload does not match this login request")
+	}
+
+	fmt.Printf("\nAdd the following to %s:\n\n"+
+		"forums:\n"+
+		"    %s:\n"+
+		"        user_api_key: %s\n"+
+		"        user_api_client_id: %s\n", configPath, baseURL, result.Key, clientID)
+	return nil
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("cannot generate random data: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
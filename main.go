@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -11,44 +14,237 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/niemeyer/discedit/discourse"
 	"github.com/niemeyer/discedit/shlex"
 )
 
 var (
-	debug = flag.Bool("debug", false, "Debug mode")
+	debug     = flag.Bool("debug", false, "Debug mode")
+	showStats = flag.Bool("stats", false, "Print API usage and timing statistics at the end")
+	dryRun    = flag.Bool("dry-run", false, "Show changes that would be made without saving anything")
+
+	writeDelay = flag.Duration("delay", 0, "Minimum time between requests that change the forum (e.g. 2s)")
+	reportDir  = flag.String("report", "", "Write diffs of changes into the given directory instead of saving them")
+
+	transferTimeout = flag.Duration("transfer-timeout", 10*time.Minute, "Time limit for uploads, downloads, and loading many posts at once (0 for none)")
+	metricsAddr     = flag.String("metrics", "", "Serve Prometheus metrics at /metrics on the given address (e.g. :9100)")
 
 	ignoreDraft = flag.Bool("ignore-draft", false, "Ignore existing draft and start over")
 	forceDraft  = flag.Bool("force-draft", false, "Open draft even if it has conflicts")
 	liveEdit    = flag.Bool("live-edit", false, "Update post while content is being edited")
+
+	liveInterval  = flag.Duration("live-interval", 0, "Minimum time between live edit saves, with changes meanwhile saved as a draft (e.g. 5m)")
+	liveMinChange = flag.Int("live-min-change", 0, "Minimum number of changed lines for a live edit save, with smaller changes saved as a draft")
+
+	strictWhitespace = flag.Bool("strict-whitespace", false, "Consider whitespace-only changes as changes to be saved")
+	ignoreWhitespace = flag.Bool("ignore-whitespace", false, "Ignore changes in the amount of whitespace when comparing and showing diffs")
+
+	formatTables = flag.Bool("format-tables", false, "Align and pad markdown tables before saving")
+	typography   = flag.String("typography", "preserve", "Convert smart quotes, dashes, and non-breaking spaces: preserve, code, or all")
+	preview      = flag.Bool("preview", false, "Show the rendered content before and after saving side by side")
+
+	snapshotInterval = flag.Int("snapshot-interval", 5, "Minutes between local snapshots of the content being edited (0 to disable)")
+
+	lastTopic = flag.Bool("last", false, "Edit the most recently edited topic again, with no URL")
+	newTopic  = flag.Bool("new", false, "Write a new topic in the category given with -category, instead of editing one")
+	replyTo   = flag.Bool("reply", false, "Write a new reply to the topic or post with the given URL, instead of editing it")
+
+	dumpCategoryPath = flag.String("dump-category", "", "Download all topics in the category with the given URL or slug into the directory provided")
+	pushDir          = flag.String("push", "", "Publish the files changed locally in the given mirror directory back to their topics")
+
+	editNotice  = flag.Bool("notice", false, "Edit the staff notice of the post instead of its content")
+	authorPosts = flag.Bool("author-posts", false, "Edit the first post and all replies by its author together")
+	allWiki     = flag.Bool("all-wiki", false, "Edit every wiki post in the topic, one after the other")
+	assign      = flag.Bool("assign", false, "Assign the topic to yourself while editing (requires the assign plugin)")
+	saveFrom    = flag.String("save", "", "Save the content of the given file (- for stdin) instead of opening an editor")
+	locale      = flag.String("locale", "", "Edit the translation of the post into the given locale instead of its content")
+
+	confirmRecent = flag.Duration("confirm-recent", 0, "Ask before editing posts changed by someone else within the given time (e.g. 30m)")
+	conflict      = flag.String("conflict", "", "What to do when someone else changed the content meanwhile: ask, merge, resolve, ours, theirs, or abort")
+
+	forceOverwrite = flag.Bool("force-overwrite", false, "Save without checking whether someone else changed the content meanwhile")
+
+	editReason = flag.String("edit-reason", "", "Reason for the change, shown in the revision history of the post")
+	changelog  = flag.Bool("changelog", false, "Reply to the topic with a summary of the change after saving")
+
+	autoEditReason = flag.Bool("auto-edit-reason", false, "Describe the change in the revision history when -edit-reason is not provided")
+
+	valuesPath = flag.String("values", "", "YAML file with values for {{name}} placeholders replaced when publishing")
+
+	waitCooldown = flag.Bool("wait-cooldown", false, "Wait and retry when slow mode or rate limits delay saving or replying")
+
+	notify = flag.String("notify", "", "Set your notification level on the topic after saving: watching, tracking, regular, or muted")
+
+	viewCooked = flag.Bool("cooked", false, "Show the rendered content as plain text with the view command")
+
+	outputPath = flag.String("output", "", "File to write exported content to (- for stdout)")
+	jsonOutput = flag.Bool("json", false, "Output results of commands as JSON")
+	allPosts   = flag.Bool("all-posts", false, "Export every post into its own file within the -output directory")
+	category   = flag.String("category", "", "Category slug for commands that work on categories")
+	recurse    = flag.Bool("recurse", false, "Include subcategories in nested directories when mirroring")
+	env        = flag.String("env", "", "Use the forum environment with the given name (e.g. staging)")
+
+	maxImageSize = flag.Int("max-image-size", 1024, "Size in KB above which images are reported as oversized by audits")
+
+	group        = flag.String("group", "", "Group whose inbox the messages command works on")
+	recipients   = flag.String("to", "", "Comma-separated users and groups to send composed messages to")
+	composeTitle = flag.String("title", "", "Title of composed messages and new topics")
+
+	search     = flag.String("search", "", "Search query selecting the topics to retag (e.g. tags:old-tag)")
+	addTags    = flag.String("add", "", "Comma-separated tags to add to the topics found by retag")
+	removeTags = flag.String("remove", "", "Comma-separated tags to remove from the topics found by retag")
+
+	categoryName   = flag.String("name", "", "Name of the category created with category create")
+	parentCategory = flag.String("parent", "", "Path of the parent of the category created with category create")
 )
 
 type Config struct {
 	Forums map[string]*ForumConfig `json:"forums"`
+
+	// Include holds glob patterns of further configuration files.
+	Include []string `yaml:"include"`
+
+	// path is the file the configuration was read from.
+	path string
 }
 
 type ForumConfig struct {
 	Username string `yaml:"username"`
 	Key      string `yaml:"key"`
+	ReadOnly bool   `yaml:"read_only"`
+
+	// ScopedKey tells that Key is an API key granted only some scopes,
+	// such as topics read/write, so discedit avoids endpoints those do
+	// not cover, such as the draft API.
+	ScopedKey bool `yaml:"scoped_key"`
+
+	// Alias is a short name that may be used in place of the forum URL.
+	Alias string `yaml:"alias"`
+
+	// Env names the environment (e.g. staging or production) of the
+	// forum. Forums sharing an alias are environments of the same
+	// logical forum, selected with the -env option.
+	Env string `yaml:"env"`
+
+	// UserAPIKey is used instead of Username and Key for forums that
+	// do not hand out admin API keys. See the login command.
+	UserAPIKey      string `yaml:"user_api_key"`
+	UserAPIClientID string `yaml:"user_api_client_id"`
+
+	// RateLimit is the maximum number of requests per minute.
+	RateLimit int `yaml:"rate_limit"`
+
+	// Headers holds extra headers sent with every request to the
+	// forum, such as those required by an authenticating proxy.
+	Headers map[string]string `yaml:"headers"`
+
+	// UserAgent overrides the default "discedit/<version>" agent.
+	UserAgent string `yaml:"user_agent"`
+
+	// Mirrors lists directories holding mirrors of the forum, which
+	// are searched for links to headings changed while editing.
+	Mirrors []string `yaml:"mirrors"`
+
+	// ChangelogTemplate overrides the text/template used for the
+	// replies posted with -changelog. See ChangelogData.
+	ChangelogTemplate string `yaml:"changelog_template"`
+
+	// Conflict is the policy for saving content that someone else
+	// changed meanwhile. See conflictPolicies.
+	Conflict string `yaml:"conflict"`
+
+	// OnPublish is a command run after content is saved. See runOnPublish.
+	OnPublish string `yaml:"on_publish"`
+
+	// ImportUsers maps email addresses to the usernames that messages
+	// sent from them are posted as by the import command.
+	ImportUsers map[string]string `yaml:"import_users"`
 }
 
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: discedit <forum topic URL>\n\nOptions:\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: discedit <forum topic or category URL>\n"+
+			"       discedit -new -category <slug> [-title <title>] <forum URL>\n"+
+			"       discedit -reply <forum topic or post URL>\n"+
+			"       discedit -dump-category <category URL or slug> <dir>\n"+
+			"       discedit -push <dir>\n"+
+			"       discedit <command> [options] <arguments>\n\n"+
+			"Commands:\n\n"+
+			"  docs <forum URL>                 List topics indexed by the docs plugin\n"+
+			"  export-thread <forum topic URL>  Export all posts of a topic as markdown\n"+
+			"  archive <forum topic URL>        Archive a topic with revisions and uploads as JSON\n"+
+			"  audit headings <forum topic URL> Report problems in the heading structure of a topic\n"+
+			"  audit linkmap <category URL>     List the outbound links of all topics in a category\n"+
+			"  audit crosslinks <forum topic URL> [<mirror dir>...]\n"+
+			"                                   Suggest links to other topics whose titles are mentioned\n"+
+			"  audit images <topic or category URL>\n"+
+			"                                   Report broken and oversized images\n"+
+			"  print <forum topic URL>          Print the raw content of a topic\n"+
+			"  view [-cooked] <forum topic URL> Show the content of a topic in $PAGER\n"+
+			"  restore <forum topic URL>        Publish one of the local backups of a topic\n"+
+			"  notes [<forum topic URL>]        List local notes about topics\n"+
+			"  notes add <forum topic URL> <text>\n"+
+			"                                   Add a note shown whenever the topic is edited\n"+
+			"  notes clear <forum topic URL>    Remove the notes about a topic\n"+
+			"  queue add <forum topic URL>...   Queue topics to be edited later\n"+
+			"  queue list                       List the queued topics\n"+
+			"  queue run                        Edit the queued topics in turn\n"+
+			"  meta <forum topic URL>           Print the title, category, tags, and edit state of a topic\n"+
+			"  translations <forum topic URL>   List the translations of a topic\n"+
+			"  draft get <forum topic URL>      Print the server draft of a topic\n"+
+			"  draft put <forum topic URL> <file>\n"+
+			"                                   Save the file content as the server draft of a topic\n"+
+			"  upload <forum URL> <file>...     Upload files and print the markdown to show them\n"+
+			"  import -category <slug> <forum URL> <mbox or eml file>...\n"+
+			"                                   Import an email thread as a topic with replies\n"+
+			"  login <forum URL>                Obtain a user API key for the forum\n"+
+			"  config encrypt|decrypt           Encrypt or decrypt the configuration file\n"+
+			"  sessions [<session ID>]          Review past editing sessions\n"+
+			"  mirror <category URL> <dir>      Download all topics in a category into dir\n"+
+			"  mirror status <dir>              Report mirrored topics changed locally or remotely\n"+
+			"  category create -name <name> [-parent <path>] <forum URL>\n"+
+			"                                   Create a category, unless it exists already\n"+
+			"  category snapshot <category URL> <dir>\n"+
+			"                                   Archive all topics in a category into dir\n"+
+			"  category restore <category URL> <dir>\n"+
+			"                                   Recreate or update the topics archived in dir\n"+
+			"  retag -search <query> [-add <tags>] [-remove <tags>] <forum URL>\n"+
+			"                                   Add and remove tags on all topics matching a search\n"+
+			"  latest [-category <slug>] <forum URL>\n"+
+			"                                   List the latest topics and pick them for editing\n"+
+			"  list -category <slug> <forum URL>\n"+
+			"                                   List topics in a category and pick them for editing\n"+
+			"  messages -group <name> <forum URL>\n"+
+			"                                   List messages in a group inbox and pick them for editing\n"+
+			"  compose -to <recipients> -title <title> <forum URL>\n"+
+			"                                   Write and send a new personal message\n\n"+
+			"Options:\n\n")
 		flag.PrintDefaults()
 	}
-	if err := run(); err != nil {
+	err := run()
+	if *showStats {
+		stats.Print()
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// version is the discedit version, which may be set at build time with:
+//
+//	go build -ldflags "-X main.version=1.0"
+var version = "devel"
+
 var configPath = "$HOME/.discedit"
 var configErr error
 
@@ -62,46 +258,498 @@ func init() {
 		"        key: your-key\n", configPath)
 }
 
+// systemConfigPath holds forum definitions shipped by administrators.
+var systemConfigPath = "/etc/discedit/config.yaml"
+
+// localConfigName is the name of the configuration file looked for in
+// the current directory and its parents, such as a docs repository.
+const localConfigName = ".discedit.yaml"
+
+// configPaths returns the paths of all configuration files, in the order
+// they are merged. Settings from later files take precedence.
+func configPaths() []string {
+	paths := []string{systemConfigPath, configPath}
+	if path := localConfigPath(); path != "" {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// localConfigPath returns the path of the configuration file found in
+// the current directory or its nearest parent that has one, or an empty
+// string if there is none. Such files come along with what is checked
+// out and so are not trusted with settings that run commands or change
+// where and how requests are sent. See checkLocalConfig.
+func localConfigPath() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, localConfigName)
+		if _, err := os.Stat(path); err == nil {
+			if path == configPath {
+				return ""
+			}
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// checkLocalConfig returns an error if config, read from the file
+// returned by localConfigPath, has settings such files may not use.
+func checkLocalConfig(config *Config) error {
+	const reason = "as it was found in the current directory or its parents"
+	if len(config.Include) > 0 {
+		return fmt.Errorf("%s cannot include other files, %s", config.path, reason)
+	}
+	for baseURL, fconfig := range config.Forums {
+		if fconfig.OnPublish != "" {
+			return fmt.Errorf("%s cannot set on_publish for forum %s, %s", config.path, baseURL, reason)
+		}
+		if len(fconfig.Headers) > 0 {
+			return fmt.Errorf("%s cannot set headers for forum %s, %s", config.path, baseURL, reason)
+		}
+	}
+	return nil
+}
+
 func readConfig() (*Config, error) {
+	config := &Config{Forums: make(map[string]*ForumConfig)}
+	var layers []*Config
+	var visited = make(map[string]bool)
+	local := localConfigPath()
+	for _, path := range configPaths() {
+		if path == local {
+			// Read on its own, as includes are not allowed.
+			if visited[path] {
+				continue
+			}
+			visited[path] = true
+			layer, err := readConfigFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err == nil {
+				err = checkLocalConfig(layer)
+			}
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, layer)
+			continue
+		}
+		fileLayers, err := readConfigLayers(path, visited)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, fileLayers...)
+	}
+	found := len(layers) > 0
+
+	// Settings are checked in the file they come from, so errors may
+	// point there, before layers are merged.
+	forumPaths := make(map[string][]string)
+	aliasPaths := make(map[string]string)
+	for _, layer := range layers {
+		for baseURL, fconfig := range layer.Forums {
+			if strings.ContainsAny(fconfig.Alias, ":/") {
+				return nil, fmt.Errorf("%s has invalid alias %q for forum %s", layer.path, fconfig.Alias, baseURL)
+			}
+			if fconfig.Conflict != "" && !conflictPolicies[fconfig.Conflict] {
+				return nil, fmt.Errorf("%s has invalid conflict policy %q for forum %s", layer.path, fconfig.Conflict, baseURL)
+			}
+			if fconfig.RateLimit < 0 {
+				return nil, fmt.Errorf("%s has invalid rate_limit for forum %s", layer.path, baseURL)
+			}
+			if fconfig.Alias != "" {
+				aliasPaths[baseURL] = layer.path
+			}
+			forumPaths[baseURL] = append(forumPaths[baseURL], layer.path)
+		}
+	}
+	for _, layer := range layers {
+		for baseURL, fconfig := range layer.Forums {
+			if config.Forums[baseURL] == nil {
+				config.Forums[baseURL] = fconfig
+			} else {
+				config.Forums[baseURL].merge(fconfig)
+			}
+		}
+	}
+	if !found || len(config.Forums) == 0 {
+		return nil, configErr
+	}
+
+	aliases := make(map[string]string)
+	for baseURL, fconfig := range config.Forums {
+		if fconfig.Alias != "" {
+			key := fconfig.Alias + " " + fconfig.Env
+			if other, ok := aliases[key]; ok {
+				if aliasPaths[other] == aliasPaths[baseURL] {
+					return nil, fmt.Errorf("%s uses alias %q for both %s and %s", aliasPaths[baseURL], fconfig.Alias, other, baseURL)
+				}
+				return nil, fmt.Errorf("%s and %s use alias %q for both %s and %s", aliasPaths[other], aliasPaths[baseURL], fconfig.Alias, other, baseURL)
+			}
+			aliases[key] = baseURL
+		}
+		if fconfig.UserAPIKey == "" && (fconfig.Username == "" || fconfig.Key == "") {
+			return nil, fmt.Errorf("no username or key for forum %s in %s", baseURL, strings.Join(forumPaths[baseURL], ", "))
+		}
+	}
+	return config, nil
+}
+
+// readConfigLayers reads the configuration file at path and the files
+// it includes, and returns them in the order they must be merged. The
+// included files come first, so settings in the including file take
+// precedence. Files already visited are skipped to prevent loops.
+func readConfigLayers(path string, visited map[string]bool) ([]*Config, error) {
+	if visited[path] {
+		return nil, nil
+	}
+	visited[path] = true
+
+	config, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var layers []*Config
+	for _, pattern := range config.Include {
+		pattern = os.ExpandEnv(pattern)
+		if strings.HasPrefix(pattern, "~/") {
+			pattern = os.ExpandEnv("$HOME") + pattern[1:]
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s has invalid include pattern %q: %v", path, pattern, err)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			included, err := readConfigLayers(match, visited)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, included...)
+		}
+	}
+	return append(layers, config), nil
+}
+
+// readConfigFile reads a single configuration file. If the file does
+// not exist the returned error satisfies os.IsNotExist.
+func readConfigFile(path string) (*Config, error) {
 	var config Config
 
-	data, err := ioutil.ReadFile(configPath)
+	// Only the user configuration is written by discedit itself.
+	if path == configPath {
+		unlock, err := lockPath(configPath)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	data, err := ioutil.ReadFile(path)
 	if os.IsNotExist(err) {
-		return nil, configErr
+		return nil, err
 	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot read %s: %v", configPath, err)
+		return nil, fmt.Errorf("cannot read %s: %v", path, err)
+	}
+	if isEncrypted(data) {
+		passphrase, err := readPassphrase("Passphrase for " + path + ": ")
+		if err != nil {
+			return nil, err
+		}
+		data, err = decryptConfig(data, passphrase)
+		if err != nil {
+			return nil, err
+		}
 	}
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
-		return nil, fmt.Errorf("cannot unmarshal %s: %v", configPath, err)
-	}
-	if len(config.Forums) == 0 {
-		return nil, configErr
+		return nil, fmt.Errorf("cannot unmarshal %s: %v", path, err)
 	}
 
+	forums := make(map[string]*ForumConfig)
 	for baseURL, fconfig := range config.Forums {
 		cleanURL := strings.TrimRight(baseURL, "/")
 		_, _, err = parseTopicURL(cleanURL + "/t/123")
 		if err != nil {
-			return nil, fmt.Errorf("%s has invalid forum URL: %q", configPath, baseURL)
+			return nil, fmt.Errorf("%s has invalid forum URL: %q", path, baseURL)
 		}
-		if cleanURL != baseURL {
-			config.Forums[cleanURL] = fconfig
-			delete(config.Forums, baseURL)
-		}
-		if fconfig.Username == "" || fconfig.Key == "" {
-			return nil, fmt.Errorf("%s misses username or key for forum %s", configPath, baseURL)
+		if fconfig == nil {
+			fconfig = &ForumConfig{}
 		}
+		forums[cleanURL] = fconfig
 	}
+	config.Forums = forums
+	config.path = path
 	return &config, nil
 }
 
+// expandAlias replaces a forum alias at the start of arg by the
+// forum URL. The alias may be used alone, followed by a colon and a
+// topic ID (e.g. "ubuntu:12345"), or followed by a URL path (e.g.
+// "ubuntu/t/slug/12345"). Other arguments are returned unchanged,
+// other than for the normalization done by normalizeURL.
+func (config *Config) expandAlias(arg string) string {
+	arg = normalizeURL(arg)
+	if strings.Contains(arg, "://") {
+		return arg
+	}
+	name, rest, sep := arg, "", ""
+	if i := strings.IndexAny(arg, ":/"); i >= 0 {
+		name, rest, sep = arg[:i], arg[i+1:], arg[i:i+1]
+	}
+	var baseURL string
+	for url, fconfig := range config.Forums {
+		if fconfig.Alias != name || name == "" {
+			continue
+		}
+		// Environments are selected by openForum. Prefer the default
+		// one here so that the choice is deterministic.
+		if baseURL == "" || fconfig.Env == "" || fconfig.Env == "production" {
+			baseURL = url
+		}
+	}
+	if baseURL != "" {
+		switch sep {
+		case "":
+			return baseURL
+		case ":":
+			return baseURL + "/t/" + rest
+		default:
+			return baseURL + "/" + rest
+		}
+	}
+	return arg
+}
+
+// selectEnv returns the base URL of the forum in the environment chosen
+// via the -env option that corresponds to the forum at baseURL.
+func (config *Config) selectEnv(baseURL string) (string, error) {
+	fconfig := config.Forums[baseURL]
+	if *env == "" || fconfig == nil || fconfig.Env == *env {
+		return baseURL, nil
+	}
+	if fconfig.Alias != "" {
+		for url, other := range config.Forums {
+			if other.Alias == fconfig.Alias && other.Env == *env {
+				logf("Using %s environment at %s.", *env, url)
+				return url, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("forum %s has no %s environment defined in %s", baseURL, *env, configPath)
+}
+
+// merge overrides settings in fc with those set in other.
+func (fc *ForumConfig) merge(other *ForumConfig) {
+	if other.Username != "" {
+		fc.Username = other.Username
+	}
+	if other.Key != "" {
+		fc.Key = other.Key
+	}
+	if other.ReadOnly {
+		fc.ReadOnly = true
+	}
+	if other.ScopedKey {
+		fc.ScopedKey = true
+	}
+	if other.UserAPIKey != "" {
+		fc.UserAPIKey = other.UserAPIKey
+	}
+	if other.UserAPIClientID != "" {
+		fc.UserAPIClientID = other.UserAPIClientID
+	}
+	if other.RateLimit != 0 {
+		fc.RateLimit = other.RateLimit
+	}
+	for name, value := range other.Headers {
+		if fc.Headers == nil {
+			fc.Headers = make(map[string]string)
+		}
+		fc.Headers[name] = value
+	}
+	if other.UserAgent != "" {
+		fc.UserAgent = other.UserAgent
+	}
+	if other.Alias != "" {
+		fc.Alias = other.Alias
+	}
+	if other.Env != "" {
+		fc.Env = other.Env
+	}
+	if len(other.Mirrors) > 0 {
+		fc.Mirrors = other.Mirrors
+	}
+	if other.ChangelogTemplate != "" {
+		fc.ChangelogTemplate = other.ChangelogTemplate
+	}
+	if other.Conflict != "" {
+		fc.Conflict = other.Conflict
+	}
+	if other.OnPublish != "" {
+		fc.OnPublish = other.OnPublish
+	}
+	if len(other.ImportUsers) > 0 {
+		fc.ImportUsers = other.ImportUsers
+	}
+}
+
+type command func(config *Config, args []string) error
+
+var commands = map[string]command{
+	"archive":       runArchive,
+	"audit":         runAudit,
+	"category":      runCategory,
+	"compose":       runCompose,
+	"docs":          runDocs,
+	"draft":         runDraft,
+	"export-thread": runExportThread,
+	"import":        runImport,
+	"latest":        runLatest,
+	"list":          runList,
+	"messages":      runMessages,
+	"meta":          runMeta,
+	"mirror":        runMirror,
+	"notes":         runNotes,
+	"print":         runPrint,
+	"queue":         runQueue,
+	"restore":       runRestore,
+	"retag":         runRetag,
+	"translations":  runTranslations,
+	"upload":        runUpload,
+	"view":          runView,
+}
+
+// setupCommands do not depend on the configuration being available.
+var setupCommands = map[string]func(args []string) error{
+	"config":   runConfig,
+	"login":    runLogin,
+	"sessions": runSessions,
+}
+
 func run() error {
 	flag.Parse()
 
+	if *metricsAddr != "" {
+		err := serveMetrics(*metricsAddr)
+		if err != nil {
+			return err
+		}
+	}
+
 	args := flag.Args()
 
+	if len(args) > 0 && setupCommands[args[0]] != nil {
+		cmd := setupCommands[args[0]]
+		flag.CommandLine.Parse(args[1:])
+		return cmd(flag.Args())
+	}
+
+	if len(args) > 0 && commands[args[0]] != nil {
+		cmd := commands[args[0]]
+		// Allow options to follow the command name as well.
+		flag.CommandLine.Parse(args[1:])
+		config, err := readConfig()
+		if err != nil {
+			return err
+		}
+		return cmd(config, flag.Args())
+	}
+
+	if *dumpCategoryPath != "" {
+		config, err := readConfig()
+		if err != nil {
+			return err
+		}
+		return dumpCategory(config, *dumpCategoryPath, args)
+	}
+
+	if *pushDir != "" {
+		if len(args) != 0 {
+			return fmt.Errorf("-push expects no arguments")
+		}
+		config, err := readConfig()
+		if err != nil {
+			return err
+		}
+		return pushMirror(config, *pushDir)
+	}
+
+	if *newTopic {
+		// Options may follow the forum URL, as in -new <URL> -category docs.
+		if len(args) > 1 {
+			args = append(args[:1], subcommandArgs(args[1:])...)
+		}
+		if len(args) != 1 {
+			return fmt.Errorf("-new expects a single forum URL")
+		}
+		config, err := readConfig()
+		if err != nil {
+			return err
+		}
+		return createTopic(config, args[0])
+	}
+
+	if *replyTo {
+		if len(args) != 1 {
+			return fmt.Errorf("-reply expects a single topic or post URL")
+		}
+		config, err := readConfig()
+		if err != nil {
+			return err
+		}
+		return replyTopic(config, args[0])
+	}
+
+	if *lastTopic && len(args) == 0 {
+		url, err := lastEditedURL()
+		if err != nil {
+			return err
+		}
+		args = []string{url}
+	}
+
+	// Within a mirror, such as a docs repository, the topic may be
+	// found from the mirrored file instead.
+	var mirrored string
+	if len(args) == 1 {
+		if info, err := os.Stat(args[0]); err == nil && info.Mode().IsRegular() {
+			mirrored = args[0]
+		}
+	}
+	if len(args) == 0 || mirrored != "" {
+		mirror, err := findMirror(filepath.Dir(mirrored))
+		if err != nil {
+			return err
+		}
+		if mirror == nil && mirrored != "" {
+			return fmt.Errorf("%s is not within a mirror", mirrored)
+		}
+		if mirror != nil {
+			config, err := readConfig()
+			if err != nil {
+				return err
+			}
+			return editMirrored(config, mirror, mirrored)
+		}
+	}
+
 	if len(args) != 1 {
 		flag.Usage()
 		os.Exit(1)
@@ -112,44 +760,157 @@ func run() error {
 		return err
 	}
 
-	baseURL, topicID, err := parseTopicURL(args[0])
+	forum, topicID, postNumber, err := openPost(config, args[0])
 	if err != nil {
 		return err
 	}
 
-	fconfig := config.Forums[baseURL]
-	if fconfig == nil {
-		return fmt.Errorf("%s misses username and key for forum %s", configPath, baseURL)
+	return editTopic(forum, topicID, postNumber)
+}
+
+// subcommandArgs parses options following the name of a subcommand,
+// as done for command names, and returns the remaining arguments.
+func subcommandArgs(args []string) []string {
+	flag.CommandLine.Parse(args)
+	return flag.Args()
+}
+
+// editTopic runs the editing session selected via options on the post
+// with the given number in the topic, which is 1 for the first post.
+func editTopic(forum *Forum, topicID, postNumber int) error {
+	_, err := editTopicSaved(forum, topicID, postNumber)
+	return err
+}
+
+// editTopicSaved is like editTopic, but also reports whether the post
+// was saved. Editing modes other than the plain editing of the post,
+// such as -notice, are reported as saved when they succeed.
+func editTopicSaved(forum *Forum, topicID, postNumber int) (saved bool, err error) {
+	err = checkTypographyMode(*typography)
+	if err != nil {
+		return false, err
+	}
+	err = checkNotificationLevel(*notify)
+	if err != nil {
+		return false, err
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return false, err
 	}
 
-	forum := &Forum{
-		config:  fconfig,
-		baseURL: baseURL,
+	stats.Phase("load")
+	topic, err := forum.LoadTopicPost(topicID, postNumber)
+	if err != nil {
+		return false, err
+	}
+
+	showNotes(forum, topic)
+
+	session, attached, err := startTopicSession(forum, topic)
+	if err != nil || attached {
+		return false, err
 	}
+	defer session.End()
+	topic.session = session
 
-	topic, err := forum.LoadTopic(topicID)
+	err = recordHistory(forum, topic)
 	if err != nil {
-		return err
+		debugf("Cannot record topic in history: %v", err)
+	}
+
+	journal.Start(forum, topic)
+	defer func() { journal.End(err) }()
+
+	if forum.readOnlyMode && !*dryRun {
+		logf("WARNING: Forum %s is in read-only mode, so changes cannot be saved right now.", forum.baseURL)
+		if !confirm("Edit anyway and keep changes in a local backup if saving fails?") {
+			return false, fmt.Errorf("forum is in read-only mode")
+		}
+	}
+
+	if *assign {
+		unassign, err := forum.AssignTopic(topic)
+		if err != nil {
+			return false, err
+		}
+		defer unassign()
+	}
+
+	switch {
+	case *editNotice:
+		err = runNotice(forum, topic)
+		return err == nil, err
+	case *locale != "":
+		err = runLocale(forum, topic, *locale)
+		return err == nil, err
+	case *authorPosts:
+		err = runAuthorPosts(forum, topic)
+		return err == nil, err
+	case *allWiki:
+		err = runAllWiki(forum, topic)
+		return err == nil, err
+	}
+
+	saved, err = editPost(forum, topic)
+	if saved && *notify != "" {
+		if err := forum.SetNotificationLevel(topic, *notify); err != nil {
+			logf("WARNING: %v", err)
+		}
+	}
+	if saved && !*dryRun {
+		// Printed even in quiet mode, for scripts to pick up.
+		fmt.Println(topic.PostURL(forum))
+	}
+	return saved, err
+}
+
+// editPost runs a complete editing session on topic.Post, from
+// loading its draft to saving the edited content. It reports
+// whether the post was saved at the end of the session.
+func editPost(forum *Forum, topic *Topic) (saved bool, err error) {
+	if !topic.Post.CanEdit {
+		msg := fmt.Sprintf("forum does not allow the configured user to edit %s, most likely because the edit window of the post expired (staff may still edit it)", topic)
+		if !*dryRun {
+			return false, errors.New(msg)
+		}
+		logf("WARNING: Saving would fail: %s", msg)
 	}
 
 	if !*ignoreDraft {
 		err = forum.LoadDraft(topic)
 		if err != nil && !isNotFound(err) {
-			return err
+			return false, err
 		}
 		err = topic.CheckDraft()
 		if err != nil {
-			if *forceDraft {
+			switch {
+			case *forceDraft:
 				logf("Previous draft has problems: %s", err)
 				logf("Using draft anyway due to -force-draft")
-			} else {
-				return err
+			case isTerminal(os.Stdin) && confirm("Draft conflicts with changes made to the post meanwhile. Resolve hunk by hunk?"):
+				err = resolveDraft(topic)
+				if err != nil {
+					return false, err
+				}
+			default:
+				return false, err
 			}
 		}
 	}
 
+	if *changelog {
+		checkSlowMode(topic)
+	}
+
+	err = checkLastEdit(forum, topic.Post)
+	if err != nil {
+		return false, err
+	}
+
 	var initial = topic.OriginalText()
 
+	stats.Phase("edit")
 	var different, empty bool
 	filename, err := edit(forum, topic)
 	if err == nil {
@@ -158,34 +919,249 @@ func run() error {
 		different, empty, err = fileChanged(filename, topic.OriginalText())
 	}
 	if filename != "" && different && !empty {
-		defer renameToLast(filename)
+		defer func() {
+			if data, err := ioutil.ReadFile(filename); err == nil {
+				keepBackup(forum, topic, string(data))
+			}
+			renameToLast(filename)
+		}()
 	}
 	if err != nil {
-		return err
+		return false, err
 	}
 	if empty {
 		os.Remove(filename)
-		return fmt.Errorf("no content provided, aborting")
+		return false, fmt.Errorf("no content provided, aborting")
 	}
 	if !different {
-		if *liveEdit && initial != topic.OriginalText() {
+		saved = *liveEdit && initial != topic.OriginalText()
+		if saved {
 			logf("Changes already saved.")
 		} else {
 			logf("No changes to save.")
 		}
 		os.Remove(filename)
-		return nil
+		return saved, nil
 	}
 
-	err = forum.SaveTopic(topic, filename)
+	err = checkContent(forum, topic, filename)
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	stats.Phase("save")
+	var oldCooked, oldText string
+	for {
+		oldCooked = topic.Post.Cooked
+		oldText = topic.OriginalText()
+		err = forum.SaveTopic(topic, filename)
+		if err == nil {
+			break
+		}
+		logf("Cannot save %s: %v", topic, err)
+		retry, err := recoverSave(forum, topic, filename, err)
+		if !retry || err != nil {
+			return false, err
+		}
+	}
+	journal.Record("save", "")
+
+	if *changelog {
+		if err := postChangelog(forum, topic, oldText, topic.Post.Raw); err != nil {
+			logf("WARNING: %v", err)
+		}
+	}
+
+	if err := runOnPublish(forum, topic, oldText, topic.Post.Raw); err != nil {
+		logf("WARNING: %v", err)
+	}
+
+	if *preview {
+		if *dryRun {
+			logf("Dry run: content is only rendered by the forum once saved, so there is nothing to preview.")
+		} else if err := writePreview(forum, topic, oldCooked, topic.Post.Cooked); err != nil {
+			logf("WARNING: %v", err)
+		}
+	}
+
+	return true, nil
+}
+
+// checkContent warns about questionable content in filename, and
+// checks it for problems that would have the forum reject it, which
+// the user is offered to fix in place before going any further.
+func checkContent(forum *Forum, topic *Topic, filename string) error {
+	for {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("cannot read edited content at %s: %v", filename, err)
+		}
+		for _, problem := range auditHeadings(topic.Title, string(content)) {
+			logf("WARNING: %s", problem)
+		}
+		for _, problem := range checkEmojis(forum, string(content)) {
+			logf("WARNING: %s", problem)
+		}
+		for _, problem := range checkMentions(forum, string(content)) {
+			logf("WARNING: %s", problem)
+		}
+		for _, problem := range checkHashtags(forum, string(content)) {
+			logf("WARNING: %s", problem)
+		}
+		err = warnChangedAnchors(forum, topic, string(content))
+		if err != nil {
+			logf("WARNING: %v", err)
+		}
+
+		// Catch what the forum would reject while the content
+		// may still be fixed in place.
+		problems := validatePost(forum, topic, string(content))
+		if strings.Contains(string(content), conflictMarker) {
+			problems = append(problems, "content has unresolved conflicts")
+		}
+		if len(problems) == 0 {
+			break
+		}
+		for _, problem := range problems {
+			logf("Problem: %s", problem)
+		}
+		if !confirm("Reopen the editor to fix these problems?") {
+			return fmt.Errorf("content would be rejected by the forum, aborting")
+		}
+		err = runEditor(filename)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// reopenAfterFailure reopens the editor on filename after saving its
+// content failed with saveErr. If someone else changed the post in the
+// forum meanwhile, their changes are merged into the file first, with
+// conflict markers around overlapping changes, and the post is updated
+// so the next save goes over their changes.
+func reopenAfterFailure(forum *Forum, topic *Topic, filename string, saveErr error) error {
+	if isConflict(saveErr) {
+		current, err := forum.LoadPost(topic.Post.ID)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("cannot read edited content at %s: %v", filename, err)
+		}
+		merged, conflicts := merge3(storedText(topic.OriginalText()), storedText(string(content)), storedText(current.Raw))
+		err = ioutil.WriteFile(filename, []byte(merged+"\n"), 0600)
+		if err != nil {
+			return fmt.Errorf("cannot write merged content to %s: %v", filename, err)
+		}
+		if conflicts > 0 {
+			logf("Changes made in the forum were merged into your content, with %d conflicts to resolve between %q and %q markers.", conflicts, conflictMarker, ">>>>>>> forum")
+		} else {
+			logf("Changes made in the forum were merged into your content.")
+		}
+		topic.Post = current
+		topic.Draft = nil
+	}
+	err := runEditor(filename)
+	if err != nil {
+		return err
+	}
+	return checkContent(forum, topic, filename)
+}
+
+func openForum(config *Config, baseURL string) (*Forum, error) {
+	baseURL, err := config.selectEnv(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	fconfig := config.Forums[baseURL]
+	if fconfig == nil {
+		return nil, fmt.Errorf("%s misses username and key for forum %s", configPath, baseURL)
+	}
+	forum := &Forum{
+		config:   fconfig,
+		baseURL:  baseURL,
+		noDrafts: fconfig.ScopedKey,
+	}
+	if *conflict != "" && !conflictPolicies[*conflict] {
+		return nil, fmt.Errorf("invalid -conflict policy %q", *conflict)
+	}
+	if *reportDir != "" {
+		// Reports are written instead of changing anything.
+		*dryRun = true
+	}
+	if fconfig.RateLimit > 0 {
+		forum.limiter = newRateLimiter(fconfig.RateLimit)
+	}
+	if *writeDelay > 0 {
+		forum.writeLimiter = &rateLimiter{interval: *writeDelay}
+	}
+	return forum, nil
+}
+
+// openTopic returns the forum and topic ID referenced by topicURL.
+// Category URLs are resolved to the category's "About" topic.
+func openTopic(config *Config, topicURL string) (forum *Forum, topicID int, err error) {
+	forum, topicID, _, err = openPost(config, topicURL)
+	return forum, topicID, err
+}
+
+// categoryTopicID returns the ID of the topic describing category.
+// Its topic_url is a path that includes the subpath of forums installed
+// under one, so it is resolved against the forum host before parsing.
+func (f *Forum) categoryTopicID(category *Category) (int, error) {
+	_, topicID, err := parseTopicURL(f.absoluteURL(category.TopicURL))
+	return topicID, err
+}
+
+// openPost is like openTopic, but also returns the number of the post
+// referenced by postURL, which is 1 unless the URL points to a reply.
+func openPost(config *Config, postURL string) (forum *Forum, topicID, postNumber int, err error) {
+	postURL = config.expandAlias(postURL)
+	if categoryURLPattern.MatchString(postURL) {
+		baseURL, categoryPath, err := parseCategoryURL(postURL)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		forum, err = openForum(config, baseURL)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		category, err := forum.LoadCategory(categoryPath)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if category.TopicURL == "" {
+			return nil, 0, 0, fmt.Errorf("category %q has no description topic", category.Name)
+		}
+		topicID, err = forum.categoryTopicID(category)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		return forum, topicID, 1, nil
+	}
+
+	baseURL, topicID, postNumber, err := parsePostURL(postURL)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	forum, err = openForum(config, baseURL)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return forum, topicID, postNumber, nil
+}
+
 func renameToLast(filename string) {
+	unlock, err := lockPath(configPath + ".last.md")
+	if err != nil {
+		logf("WARNING: Cannot save backup: %v", err)
+		return
+	}
+	defer unlock()
 	renameErr := os.Rename(filename, configPath + ".last.md")
 	if renameErr != nil {
 		logf("WARNING: Cannot save backup: %v", renameErr)
@@ -194,52 +1170,75 @@ func renameToLast(filename string) {
 	}
 }
 
-func edit(forum *Forum, topic *Topic) (filename string, err error) {
-	editor := strings.TrimSpace(os.Getenv("EDITOR"))
-	if editor == "" {
-		editor = "sensible-editor"
+func runNotice(forum *Forum, topic *Topic) error {
+	err := forum.RequireVersion("custom staff notices", "2.9.0")
+	if err != nil {
+		return err
 	}
-	args, err := shlex.Split(editor)
+
+	initial := topic.Post.NoticeText()
+
+	filename, err := createTempFile(initial)
 	if err != nil {
-		return "", fmt.Errorf("cannot parse editor command: %v", err)
+		return err
 	}
+	defer os.Remove(filename)
 
 	logf("Opening your preferred editor...")
 
-	text := topic.EditText()
-
-	tmpfile, err := os.Create(configPath + "." + strconv.Itoa(os.Getpid()) + ".md")
-	if err == nil {
-		_, err = tmpfile.Write([]byte(text))
+	err = runEditor(filename)
+	if err != nil {
+		return err
 	}
-	if err == nil {
-		err = tmpfile.Close()
+	different, _, err := fileChanged(filename, initial)
+	if err != nil {
+		return err
 	}
+	if !different {
+		logf("No changes to save.")
+		return nil
+	}
+
+	// An empty notice removes it from the post.
+	content, err := ioutil.ReadFile(filename)
 	if err != nil {
-		if tmpfile != nil {
-			tmpfile.Close()
-			os.Remove(tmpfile.Name())
+		return fmt.Errorf("cannot read edited content at %s: %v", filename, err)
+	}
+	return forum.SaveNotice(topic, string(bytes.TrimSpace(content)))
+}
+
+func edit(forum *Forum, topic *Topic) (filename string, err error) {
+	if *saveFrom != "" {
+		content, err := readSaveContent(*saveFrom)
+		if err != nil {
+			return "", err
 		}
-		return "", fmt.Errorf("cannot write temporary file: %v", err)
+		content, err = expandValues(content)
+		if err != nil {
+			return "", err
+		}
+		return createTempFile(content)
 	}
-	filename = tmpfile.Name()
 
-	args = append(args, filename)
+	text := topic.EditText()
 
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	filename, err = createTempFile(text)
+	if err != nil {
+		return "", err
+	}
+	topic.session.SetFile(filename)
 
-	stat, err := os.Stat(filename)
+	stamp, err := stampFile(filename)
 	if err != nil {
 		return filename, fmt.Errorf("cannot stat temporary file: %v", err)
 	}
 	stop := make(chan bool)
 	done := make(chan bool)
+	snapshots := newSnapshotter(topic, text)
 
 	go func() {
 		defer close(done)
+		var lastLive time.Time
 		last := false
 		for !last {
 			select {
@@ -247,48 +1246,133 @@ func edit(forum *Forum, topic *Topic) (filename string, err error) {
 			case <-stop:
 				last = true
 			}
+			snapshots.Check(filename)
 
-			curstat, err := os.Stat(filename)
+			curstamp, err := stampFile(filename)
+			if os.IsNotExist(err) {
+				// The editor is likely replacing the file, so
+				// look it up again by path next time around.
+				debugf("Waiting for %s to be saved again.", filename)
+				continue
+			}
 			if err != nil {
 				debugf("Error stating file for draft: %v", err)
 				continue
 			}
-			if curstat.ModTime() == stat.ModTime() {
+			if curstamp.Same(stamp) {
 				continue
 			}
 			different, empty, err := fileChanged(filename, text)
 			if err != nil || !different || empty {
 				continue
 			}
-			if *liveEdit {
+			live := *liveEdit && !*dryRun
+			if live {
+				var reason string
+				live, reason = liveSaveDue(filename, lastLive, topic.Post.Raw)
+				if !live {
+					debugf("Saving draft instead of live edit: %s.", reason)
+				}
+			}
+			if live {
 				err = forum.SaveTopic(topic, filename)
 				if err != nil {
 					debugf("Error saving live edit: %v", err)
+					journal.Record("live save", "error: "+err.Error())
 					// Try to save the draft at least.
+				} else {
+					journal.Record("live save", "")
+					lastLive = time.Now()
 				}
 			}
-			if !*liveEdit || err != nil {
+			if !live || err != nil {
 				err = forum.SaveDraft(topic, filename)
 				if err != nil {
 					debugf("Error saving draft: %v", err)
 					continue
 				}
 			}
-			stat = curstat
+			stamp = curstamp
 			text = topic.EditText()
 		}
 	}()
 
+	logf("Opening your preferred editor...")
+
 	quietMode = true
-	err = cmd.Run()
+	err = runEditor(filename)
 	close(stop)
 	<-done
 	quietMode = false
 
+	return filename, err
+}
+
+func createTempFile(text string) (filename string, err error) {
+	tmpfile, err := os.Create(configPath + "." + strconv.Itoa(os.Getpid()) + ".md")
+	if err == nil {
+		_, err = tmpfile.Write([]byte(text))
+	}
+	if err == nil {
+		err = tmpfile.Close()
+	}
+	if err != nil {
+		if tmpfile != nil {
+			tmpfile.Close()
+			os.Remove(tmpfile.Name())
+		}
+		return "", fmt.Errorf("cannot write temporary file: %v", err)
+	}
+	return tmpfile.Name(), nil
+}
+
+// readSaveContent returns the content to save with -save, read from
+// the named file or from the standard input if filename is "-".
+func readSaveContent(filename string) (string, error) {
+	var data []byte
+	var err error
+	if filename == "-" {
+		data, err = ioutil.ReadAll(stdinReader)
+	} else {
+		data, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read content to save: %v", err)
+	}
+	return string(data), nil
+}
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func runEditor(filename string) error {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return fmt.Errorf("cannot open an editor without a terminal (see -save to save content from a file or the standard input)")
+	}
+	editor := strings.TrimSpace(os.Getenv("EDITOR"))
+	if editor == "" {
+		editor = "sensible-editor"
+	}
+	args, err := shlex.Split(editor)
+	if err != nil {
+		return fmt.Errorf("cannot parse editor command: %v", err)
+	}
+
+	args = append(args, filename)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
 	if err != nil {
-		return filename, fmt.Errorf("cannot edit file %s: %v", filename, err)
+		return fmt.Errorf("cannot edit file %s: %v", filename, err)
 	}
-	return filename, nil
+	return nil
 }
 
 func fileChanged(filename, original string) (different, empty bool, err error) {
@@ -297,11 +1381,52 @@ func fileChanged(filename, original string) (different, empty bool, err error) {
 		return false, false, fmt.Errorf("cannot tell whether %s changed: %v", filename, err)
 	}
 	trimmed := string(bytes.TrimSpace(data))
-	different = trimmed != strings.TrimSpace(original)
+	different = !sameText(trimmed, original)
 	empty = len(trimmed) == 0
 	return different, empty, nil
 }
 
+// sameText reports whether a and b hold the same content. Unless
+// -strict-whitespace is used, differences in line endings, trailing
+// spaces, and the number of consecutive blank lines are disregarded,
+// so that editor auto-formatting does not create empty revisions.
+// With -ignore-whitespace, changes in the amount of whitespace are
+// disregarded too, as with diff -b, but words are still kept apart.
+func sameText(a, b string) bool {
+	if *ignoreWhitespace {
+		return collapseWhitespace(a) == collapseWhitespace(b)
+	}
+	if *strictWhitespace {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}
+	return normalizeWhitespace(a) == normalizeWhitespace(b)
+}
+
+// collapseWhitespace returns text with each run of whitespace replaced
+// by a single space, and leading and trailing whitespace removed.
+func collapseWhitespace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func normalizeWhitespace(text string) string {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	var result []string
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank = true
+			continue
+		}
+		if blank && len(result) > 0 {
+			result = append(result, "")
+		}
+		blank = false
+		result = append(result, line)
+	}
+	return strings.Join(result, "\n")
+}
+
 func outputErr(output []byte, err error) error {
 	output = bytes.TrimSpace(output)
 	if len(output) > 0 {
@@ -314,18 +1439,71 @@ func outputErr(output []byte, err error) error {
 	return err
 }
 
-var topicURLPattern = regexp.MustCompile("^(https?://[^/]+)?(?:/t)?(?:/([a-z0-9-]+))?/([0-9]+)(?:/[0-9]+)?$")
+// normalizeURL drops the parts of URLs copied from the forum that do
+// not matter for finding what they refer to, such as the query of
+// print views (?print=true), pages (?page=2), and share links
+// (?u=username), fragments, the /print suffix, and trailing slashes.
+func normalizeURL(rawURL string) string {
+	if i := strings.IndexAny(rawURL, "?#"); i >= 0 {
+		rawURL = rawURL[:i]
+	}
+	rawURL = strings.TrimRight(rawURL, "/")
+	if strings.HasSuffix(rawURL, "/print") && topicURLPattern.MatchString(strings.TrimSuffix(rawURL, "/print")) {
+		rawURL = strings.TrimSuffix(rawURL, "/print")
+	}
+	return rawURL
+}
+
+// Forums may be installed under a subpath (e.g. https://example.com/forum),
+// so the base URL in the patterns below may include path elements. Slugs
+// must hold a non-digit so that in /t/123/7 the 7 is taken as the number
+// of a post in topic 123, as the forum does.
+var topicURLPattern = regexp.MustCompile("^(https?://[^/]+(?:/[^/]+)*?)?(?:/t)?(?:/([a-z0-9-]*[a-z-][a-z0-9-]*))?/([0-9]+)(?:/([0-9]+))?$")
 
 func parseTopicURL(topicURL string) (baseURL string, ID int, err error) {
-	m := topicURLPattern.FindStringSubmatch(topicURL)
+	baseURL, ID, _, err = parsePostURL(topicURL)
+	return baseURL, ID, err
+}
+
+// parsePostURL is like parseTopicURL, but also returns the number of the
+// post the URL points to, such as 7 in /t/slug/123/7, or 1 if none.
+func parsePostURL(postURL string) (baseURL string, topicID, postNumber int, err error) {
+	m := topicURLPattern.FindStringSubmatch(postURL)
 	if m == nil {
-		return "", 0, fmt.Errorf("unsupported topic URL: %q", topicURL)
+		return "", 0, 0, fmt.Errorf("unsupported topic URL: %q", postURL)
 	}
-	id, err := strconv.Atoi(m[3])
+	topicID, err = strconv.Atoi(m[3])
 	if err != nil {
-		return "", 0, fmt.Errorf("internal error: URL pattern matched with non-int page ID")
+		return "", 0, 0, fmt.Errorf("internal error: URL pattern matched with non-int page ID")
+	}
+	postNumber = 1
+	if m[4] != "" {
+		postNumber, err = strconv.Atoi(m[4])
+		if err != nil || postNumber < 1 {
+			return "", 0, 0, fmt.Errorf("invalid post number in URL: %q", postURL)
+		}
+	}
+	return m[1], topicID, postNumber, nil
+}
+
+var forumURLPattern = regexp.MustCompile("^https?://[^/]+(?:/[^/]+)*$")
+
+func parseForumURL(forumURL string) (baseURL string, err error) {
+	baseURL = strings.TrimRight(forumURL, "/")
+	if !forumURLPattern.MatchString(baseURL) {
+		return "", fmt.Errorf("unsupported forum URL: %q", forumURL)
+	}
+	return baseURL, nil
+}
+
+var categoryURLPattern = regexp.MustCompile("^(https?://[^/]+(?:/[^/]+)*?)?/c/([^?#]+?)/?$")
+
+func parseCategoryURL(categoryURL string) (baseURL, categoryPath string, err error) {
+	m := categoryURLPattern.FindStringSubmatch(categoryURL)
+	if m == nil {
+		return "", "", fmt.Errorf("unsupported category URL: %q", categoryURL)
 	}
-	return m[1], id, nil
+	return m[1], m[2], nil
 }
 
 type Topic struct {
@@ -336,10 +1514,25 @@ type Topic struct {
 	BumpedAt      time.Time `json:"bumped_at"`
 	DraftKey      string    `json:"draft_key"`
 	DraftSequence int       `json:"draft_sequence"`
+	Tags          Tags      `json:"tags"`
+
+	// Slow mode limits how often each user may reply to the topic.
+	// UserLastPostedAt is only sent while slow mode is enabled.
+	SlowModeSeconds  int       `json:"slow_mode_seconds"`
+	SlowModeUntil    time.Time `json:"slow_mode_enabled_until"`
+	UserLastPostedAt time.Time `json:"user_last_posted_at"`
+
+	// AssignedTo is set by the assign plugin.
+	AssignedTo *TopicUser `json:"assigned_to_user"`
 
 	Post    *Post
+	Posts   []*Post
 	Draft   *Draft
 	content []byte
+	stream  []int
+
+	// session is set while the topic is being edited. See topicSession.
+	session *topicSession
 }
 
 func (t *Topic) EditText() string {
@@ -356,6 +1549,16 @@ func (t *Topic) OriginalText() string {
 	return t.Post.OriginalText()
 }
 
+// draftKey returns the key of the forum draft for editing t.Post.
+// Drafts for edits of replies are kept apart from the topic's, keyed
+// on the ID of the reply.
+func (t *Topic) draftKey() string {
+	if t.Post != nil && t.Post.PostNumber > 1 {
+		return fmt.Sprintf("topic_%d_post_%d", t.ID, t.Post.ID)
+	}
+	return "topic_" + strconv.Itoa(t.ID)
+}
+
 func (t *Topic) CheckDraft() error {
 	if t.Draft != nil && t.Draft.OriginalText() != t.Post.OriginalText() {
 		return fmt.Errorf("content was changed after existing draft started (see -ignore-draft and -force-draft)")
@@ -364,6 +1567,9 @@ func (t *Topic) CheckDraft() error {
 }
 
 func (t *Topic) String() string {
+	if t.Post != nil && t.Post.PostNumber > 1 {
+		return fmt.Sprintf("/%s/%d/%d", t.Slug, t.ID, t.Post.PostNumber)
+	}
 	return fmt.Sprintf("/%s/%d", t.Slug, t.ID)
 }
 
@@ -371,6 +1577,11 @@ func (t *Topic) ForumURL(forum *Forum) string {
 	return fmt.Sprintf("%s/t/%s/%d", forum.baseURL, t.Slug, t.ID)
 }
 
+// PostURL returns the canonical URL of t.Post within the topic.
+func (t *Topic) PostURL(forum *Forum) string {
+	return fmt.Sprintf("%s/%d", t.ForumURL(forum), t.Post.PostNumber)
+}
+
 func (t *Topic) LastUpdate() time.Time {
 	if t.Post == nil || t.Post.UpdatedAt.IsZero() {
 		// Search results do not include updated_at. That's the next best thing.
@@ -386,6 +1597,33 @@ func (t *Topic) Blurb() string {
 	return ""
 }
 
+type TopicUser struct {
+	Username string `json:"username"`
+}
+
+// Tags holds topic tag names. Recent Discourse versions may deliver
+// tags as objects rather than plain strings, so both are accepted.
+type Tags []string
+
+func (tags *Tags) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err == nil {
+		*tags = names
+		return nil
+	}
+	var objects []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return err
+	}
+	*tags = nil
+	for _, object := range objects {
+		*tags = append(*tags, object.Name)
+	}
+	return nil
+}
+
 type Draft struct {
 	Key      string     `json:"draft_key"`
 	TopicID  int        `json:"topic_id"`
@@ -433,13 +1671,31 @@ func (dd *DraftData) UnmarshalJSON(data []byte) error {
 
 type Post struct {
 	ID            int       `json:"id"`
+	PostNumber    int       `json:"post_number"`
 	Username      string    `json:"username"`
 	Cooked        string    `json:"cooked"`
 	Raw           string    `json:"raw"`
+	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 	TopicID       int       `json:"topic_id"`
 	Blurb         string    `json:"blurb"`
 	DraftSequence int       `json:"draft_sequence"`
+	Wiki          bool      `json:"wiki"`
+	Version       int       `json:"version"`
+	TopicSlug     string    `json:"topic_slug"`
+
+	// CanEdit reports whether the forum allows the configured user to
+	// edit the post. For non-staff users this becomes false once the
+	// edit window of the post expires.
+	CanEdit bool `json:"can_edit"`
+
+	Notice *PostNotice `json:"notice"`
+}
+
+type PostNotice struct {
+	Type   string `json:"type"`
+	Raw    string `json:"raw"`
+	Cooked string `json:"cooked"`
 }
 
 func (p *Post) EditText() string {
@@ -450,76 +1706,461 @@ func (p *Post) OriginalText() string {
 	return p.Raw
 }
 
+// NoticeText returns the raw content of the staff notice attached
+// to the post, or an empty string if there is no custom notice.
+func (p *Post) NoticeText() string {
+	if p.Notice == nil {
+		return ""
+	}
+	return p.Notice.Raw
+}
+
+type Category struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	TopicURL string `json:"topic_url"`
+}
+
 type Forum struct {
-	config  *ForumConfig
-	baseURL string
+	config   *ForumConfig
+	baseURL  string
+	limiter  *rateLimiter
+	version  string
+	username string
+
+	// writeLimiter spaces out requests that change the forum,
+	// as requested with -delay.
+	writeLimiter *rateLimiter
+
+	// siteSettings, publicSettings, and site are set once loaded
+	// from the forum.
+	siteSettings   map[string]string
+	publicSettings map[string]string
+	site           *Site
+
+	// readOnlyMode is set when the forum reports being in read-only
+	// mode, as happens during maintenance.
+	readOnlyMode bool
+
+	// noDrafts is set when the API key is not allowed to use drafts,
+	// either as configured with scoped_key or as found out when the
+	// forum refuses them. Editing then goes on without drafts.
+	noDrafts bool
 }
 
 var httpClient = &http.Client{
 	Timeout: 10 * time.Second,
 }
 
+// transferClient is used for requests that may move a lot of data,
+// such as uploads and downloads of files, which could not complete
+// within the timeout of httpClient. These are limited instead by a
+// context deadline set according to -transfer-timeout.
+var transferClient = &http.Client{}
+
+// transferContext returns the context for requests sent with transferClient.
+func transferContext() (context.Context, context.CancelFunc) {
+	if *transferTimeout > 0 {
+		return context.WithTimeout(context.Background(), *transferTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
 func (f *Forum) LoadTopic(topicID int) (topic *Topic, err error) {
+	return f.LoadTopicPost(topicID, 1)
+}
+
+// LoadTopicPost loads the topic with topic.Post set to the post with
+// the given number, so that a reply may be edited instead of the first
+// post. Replies not among the posts loaded with the topic are loaded
+// on their own.
+func (f *Forum) LoadTopicPost(topicID, postNumber int) (topic *Topic, err error) {
 
 	logf("Loading topic %d...", topicID)
 
 	var result struct {
 		*Topic
 		PostStream struct {
-			Posts []*Post
+			Posts  []*Post
+			Stream []int `json:"stream"`
 		} `json:"post_stream"`
 	}
 
-	err = f.do("GET", "/t/"+strconv.Itoa(topicID)+".json?include_raw=true", nil, &result)
+	var content json.RawMessage
+	err = f.do("GET", "/t/"+strconv.Itoa(topicID)+".json?include_raw=true", nil, &content)
 	if err != nil {
 		return nil, err
 	}
+	err = json.Unmarshal(content, &result)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode topic %d: %v", topicID, err)
+	}
 	if result.Topic == nil || len(result.PostStream.Posts) == 0 {
 		return nil, fmt.Errorf("internal error: topic %d has no posts!?", topicID)
 	}
 
 	result.Topic.Post = result.PostStream.Posts[0]
+	result.Topic.Posts = result.PostStream.Posts
+	result.Topic.content = content
+	result.Topic.stream = result.PostStream.Stream
+	if postNumber > 1 {
+		result.Topic.Post = nil
+		for _, post := range result.PostStream.Posts {
+			if post.PostNumber == postNumber && post.Raw != "" {
+				result.Topic.Post = post
+			}
+		}
+		if result.Topic.Post == nil {
+			result.Topic.Post, err = f.LoadPostByNumber(topicID, postNumber)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// The sequence in the topic is for the draft of the first post.
+		result.Topic.DraftSequence = 0
+	}
 	return result.Topic, nil
 }
 
+// postsChunkSize is the number of posts requested at once by LoadAllPosts.
+const postsChunkSize = 20
+
+// LoadAllPosts loads the posts of the topic that were not delivered
+// with the first page of its post stream, so that topic.Posts holds
+// every post in the topic, in order.
+func (f *Forum) LoadAllPosts(topic *Topic) error {
+	loaded := make(map[int]*Post)
+	for _, post := range topic.Posts {
+		loaded[post.ID] = post
+	}
+	var missing []int
+	for _, id := range topic.stream {
+		if loaded[id] == nil {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	logf("Loading %d more posts of topic %d...", len(missing), topic.ID)
+
+	for len(missing) > 0 {
+		chunk := missing
+		if len(chunk) > postsChunkSize {
+			chunk = chunk[:postsChunkSize]
+		}
+		missing = missing[len(chunk):]
+
+		query := "?include_raw=true"
+		for _, id := range chunk {
+			query += "&post_ids[]=" + strconv.Itoa(id)
+		}
+		var result struct {
+			PostStream struct {
+				Posts []*Post
+			} `json:"post_stream"`
+		}
+		err := f.doTransfer("GET", "/t/"+strconv.Itoa(topic.ID)+"/posts.json"+query, nil, &result)
+		if err != nil {
+			return err
+		}
+		for _, post := range result.PostStream.Posts {
+			loaded[post.ID] = post
+		}
+	}
+
+	topic.Posts = topic.Posts[:0]
+	for _, id := range topic.stream {
+		if post := loaded[id]; post != nil {
+			topic.Posts = append(topic.Posts, post)
+		}
+	}
+	return nil
+}
+
+// LoadRaw returns the raw content of the given post in the topic,
+// without any of the metadata delivered by LoadTopic. This is much
+// cheaper than loading the whole topic when only content is needed.
+func (f *Forum) LoadRaw(topicID, postNumber int) (string, error) {
+
+	logf("Loading raw content of topic %d...", topicID)
+
+	var data []byte
+	err := f.do("GET", "/raw/"+strconv.Itoa(topicID)+"/"+strconv.Itoa(postNumber), nil, &data)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// LoadPost loads a single post, including its raw content.
+func (f *Forum) LoadPost(postID int) (*Post, error) {
+
+	logf("Loading post %d...", postID)
+
+	var post Post
+	err := f.do("GET", "/posts/"+strconv.Itoa(postID)+".json", nil, &post)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// LoadPostIfChanged loads the post unless it still matches etag, as
+// recorded by an earlier load, in which case post is nil. The returned
+// tag is the ETag of the loaded post, or empty if the forum sent none.
+func (f *Forum) LoadPostIfChanged(postID int, etag string) (post *Post, tag string, err error) {
+
+	logf("Checking post %d...", postID)
+
+	path := "/posts/" + strconv.Itoa(postID) + ".json"
+	post = &Post{}
+	result := &taggedResult{Value: post}
+	for {
+		req, err := f.newRequest("GET", path, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		err = f.send(req, path, result)
+		if err == errNotModified {
+			return nil, etag, nil
+		}
+		if !waitCooldownAfter(path, err) {
+			if err != nil {
+				return nil, "", err
+			}
+			return post, result.ETag, nil
+		}
+	}
+}
+
+// LoadPostByNumber loads the post with the given number in the topic,
+// including its raw content.
+func (f *Forum) LoadPostByNumber(topicID, postNumber int) (*Post, error) {
+
+	logf("Loading post %d of topic %d...", postNumber, topicID)
+
+	var post Post
+	err := f.do("GET", "/posts/by_number/"+strconv.Itoa(topicID)+"/"+strconv.Itoa(postNumber)+".json", nil, &post)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// LoadCategory loads the category at the given path, which is
+// the part of the category URL after /c/ (e.g. "parent/child").
+func (f *Forum) LoadCategory(categoryPath string) (*Category, error) {
+
+	logf("Loading category %s...", categoryPath)
+
+	var result struct {
+		Category *Category `json:"category"`
+	}
+	err := f.do("GET", "/c/"+categoryPath+"/show.json", nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Category == nil {
+		return nil, fmt.Errorf("internal error: category %s has no data!?", categoryPath)
+	}
+	return result.Category, nil
+}
+
 func (f *Forum) SaveTopic(topic *Topic, filename string) error {
 	content, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return fmt.Errorf("cannot read edited content at %s: %v", filename, err)
 	}
 
+	text, err := expandValues(string(content))
+	if err != nil {
+		return err
+	}
+
 	logf("Saving topic %s ...", topic)
 
+	post, err := f.SavePost(topic.Post, text, topic.OriginalText())
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		logf("Saved %s.", topic)
+	}
+
+	topic.Post = post
+	topic.Draft = nil
+	topic.DraftSequence = topic.Post.DraftSequence
+
+	return nil
+}
+
+func (f *Forum) SaveNotice(topic *Topic, notice string) error {
+
+	if notice == "" {
+		logf("Removing staff notice from %s ...", topic)
+	} else {
+		logf("Saving staff notice for %s ...", topic)
+	}
+
+	if *dryRun {
+		logf("Dry run: not saving staff notice. Changes would be:")
+		showDiff(topic.Post.NoticeText(), notice)
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"notice": notice,
+	}
+	err := f.do("PUT", "/posts/"+strconv.Itoa(topic.Post.ID)+"/notice", body, nil)
+	if err != nil {
+		return err
+	}
+
+	if notice == "" {
+		topic.Post.Notice = nil
+	} else {
+		topic.Post.Notice = &PostNotice{Type: "custom", Raw: notice}
+	}
+
+	journal.Record("notice save", "")
+	logf("Saved staff notice for %s.", topic)
+	return nil
+}
+
+// SavePost updates the content of post to raw, and returns the updated post.
+// The update fails if the content stored in the server is not rawOld anymore.
+func (f *Forum) SavePost(post *Post, raw, rawOld string) (*Post, error) {
+
 	// Discourse drops spaces, so if we don't do this here the value of post.Raw
 	// at the end of the function gets out of sync with what's stored server side.
-	raw := string(bytes.TrimSpace(content))
+	raw = strings.TrimSpace(raw)
+
+	raw, problems := expandDates(raw)
+	for _, problem := range problems {
+		logf("WARNING: %s", problem)
+	}
+	raw = normalizeTypography(raw, *typography)
+	if *formatTables {
+		raw = alignTables(raw)
+	}
+
+	if *dryRun && *reportDir != "" {
+		err := writeReport(f, post, strings.TrimSpace(rawOld), raw)
+		if err != nil {
+			return nil, err
+		}
+		saved := *post
+		saved.Raw = raw
+		return &saved, nil
+	}
+	if *dryRun {
+		logf("Dry run: not saving post %d. Changes would be:", post.ID)
+		showDiff(rawOld, raw)
+		saved := *post
+		saved.Raw = raw
+		return &saved, nil
+	}
+
+	saved, pending, err := f.putPost(post, raw, rawOld)
+	if isConflict(err) {
+		saved, pending, err = f.resolveConflict(post, raw, rawOld, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return saved, nil
+	}
 
+	metrics.PostSaved()
+	saved.Raw = f.verifySaved(saved, saved.Raw)
+	return saved, nil
+}
+
+// putPost replaces the content of the post with raw, provided it still
+// holds rawOld in the forum, or regardless with -force-overwrite. If the
+// forum holds the change for approval by moderators, pending is true and
+// the returned post is a local copy.
+func (f *Forum) putPost(post *Post, raw, rawOld string) (saved *Post, pending bool, err error) {
+	fields := map[string]interface{}{
+		"raw": raw,
+	}
+	if *forceOverwrite {
+		logf("WARNING: Overwriting post %d regardless of changes made to it meanwhile (-force-overwrite).", post.ID)
+	} else {
+		fields["raw_old"] = rawOld
+	}
+	if reason := editReasonFor(rawOld, raw); reason != "" {
+		fields["edit_reason"] = reason
+	}
 	body := map[string]interface{}{
-		"post": map[string]interface{}{
-			"raw":     raw,
-			"raw_old": topic.OriginalText(),
-		},
+		"post": fields,
 	}
 
 	var result struct {
 		Post *Post `json:"post"`
+
+		// Action is "enqueued" when the edit awaits moderator approval.
+		Action string `json:"action"`
+	}
+	err = f.do("PUT", "/posts/"+strconv.Itoa(post.ID)+".json", body, &result)
+	if isUnauthorized(err) && f.config.ScopedKey {
+		return nil, false, fmt.Errorf("%v (the API key may not be scoped to edit posts)", err)
+	}
+	if isUnauthorized(err) {
+		return nil, false, fmt.Errorf("%v (the edit window of post %d may have expired)", err, post.ID)
 	}
-	err = f.do("PUT", "/posts/"+strconv.Itoa(topic.Post.ID)+".json", body, &result)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
+	if result.Action == "enqueued" {
+		logf("WARNING: Changes to post %d are pending approval by moderators, and will only show once approved.", post.ID)
+		saved := *post
+		saved.Raw = raw
+		return &saved, true, nil
+	}
+	if result.Post == nil {
+		return nil, false, fmt.Errorf("internal error: saving post %d returned no post data", post.ID)
+	}
+	result.Post.Raw = raw
+	return result.Post, false, nil
+}
 
-	logf("Saved %s.", topic)
-
-	topic.Post = result.Post
-	topic.Post.Raw = raw
-	topic.Draft = nil
-	topic.DraftSequence = topic.Post.DraftSequence
+// verifySaved loads the raw content of the saved post back from the forum
+// and warns loudly if it does not match the raw content that was sent,
+// other than for differences the forum is known to introduce. The raw
+// content as stored by the forum is returned, so local state stays in sync.
+func (f *Forum) verifySaved(post *Post, raw string) string {
+	stored, err := f.LoadRaw(post.TopicID, post.PostNumber)
+	if err != nil {
+		logf("WARNING: Cannot verify saved content of post %d: %v", post.ID, err)
+		return raw
+	}
+	stored = storedText(stored)
+	if stored != storedText(raw) {
+		logf("WARNING: Content stored by the forum for post %d differs from what was sent:", post.ID)
+		showDiff(raw, stored)
+	}
+	return stored
+}
 
-	return nil
+// storedText returns text as the forum stores it: with Unix line
+// endings and no leading or trailing whitespace.
+func storedText(text string) string {
+	return strings.TrimSpace(strings.Replace(text, "\r\n", "\n", -1))
 }
 
 func (f *Forum) LoadDraft(topic *Topic) error {
+	if f.noDrafts {
+		return nil
+	}
 
 	logf("Loading draft for topic %d...", topic.ID)
 
@@ -527,14 +2168,22 @@ func (f *Forum) LoadDraft(topic *Topic) error {
 		Data     *DraftData `json:"draft"`
 		Sequence int        `json:"draft_sequence"`
 	}
-	key := "topic_" + strconv.Itoa(topic.ID)
+	key := topic.draftKey()
 	err := f.do("GET", "/draft.json?draft_key="+key, nil, &result)
+	if isUnauthorized(err) {
+		f.denyDrafts(err)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
 	topic.DraftSequence = result.Sequence
-	if result.Data != nil {
+	if result.Data != nil && result.Data.Action == "reply" {
+		debugf("Ignoring reply draft for topic %d.", topic.ID)
+	} else if result.Data != nil && result.Data.PostID != topic.Post.ID {
+		debugf("Ignoring draft for post %d.", result.Data.PostID)
+	} else if result.Data != nil {
 		topic.Draft = &Draft{
 			Key:      key,
 			Sequence: result.Sequence,
@@ -551,10 +2200,18 @@ func (f *Forum) SaveDraft(topic *Topic, filename string) error {
 		return fmt.Errorf("cannot read edited content at %s: %v", filename, err)
 	}
 
+	if *dryRun {
+		debugf("Dry run: not saving draft for %s.", topic)
+		return nil
+	}
+	if f.noDrafts {
+		return errNoDrafts
+	}
+
 	logf("Saving draft for %s ...", topic)
 
 	draft := &Draft{
-		Key:      fmt.Sprintf("topic_%d", topic.ID),
+		Key:      topic.draftKey(),
 		TopicID:  topic.ID,
 		Sequence: topic.DraftSequence,
 		Data: &DraftData{
@@ -569,6 +2226,22 @@ func (f *Forum) SaveDraft(topic *Topic, filename string) error {
 		},
 	}
 
+	err = f.storeDraft(draft)
+	if err != nil {
+		return err
+	}
+
+	topic.Draft = draft
+	topic.DraftSequence = draft.Sequence
+
+	logf("Saved draft for %s.", topic)
+	return nil
+
+}
+
+// storeDraft sends draft to the forum, and updates its sequence to the
+// one the forum expects for the next update.
+func (f *Forum) storeDraft(draft *Draft) error {
 	var result struct {
 		Success       string `json:"success"`
 		DraftSequence int    `json:"draft_sequence"`
@@ -580,7 +2253,11 @@ func (f *Forum) SaveDraft(topic *Topic, filename string) error {
 		} `json:"conflict_user"`
 	}
 
-	err = f.do("POST", "/draft.json", draft, &result)
+	err := f.do("POST", "/draft.json", draft, &result)
+	if isUnauthorized(err) {
+		f.denyDrafts(err)
+		return errNoDrafts
+	}
 	if err != nil {
 		return err
 	}
@@ -593,20 +2270,42 @@ func (f *Forum) SaveDraft(topic *Topic, filename string) error {
 		return fmt.Errorf("cannot update draft: %q", msg)
 	}
 
-	topic.Draft = draft
-	topic.DraftSequence = result.DraftSequence
-
-	logf("Saved draft for %s.", topic)
+	draft.Sequence = result.DraftSequence
+	journal.Record("draft save", fmt.Sprintf("sequence %d", result.DraftSequence))
 	return nil
-
 }
 
 func (f *Forum) do(verb, path string, body, result interface{}) error {
+	for {
+		req, err := f.newRequest(verb, path, body)
+		if err != nil {
+			return err
+		}
+		err = f.send(req, path, result)
+		if !waitCooldownAfter(path, err) {
+			return err
+		}
+	}
+}
+
+// doTransfer is like do, but for requests that may take longer than
+// usual to complete. See transferClient.
+func (f *Forum) doTransfer(verb, path string, body, result interface{}) error {
+	req, err := f.newRequest(verb, path, body)
+	if err != nil {
+		return err
+	}
+	return f.sendTransfer(req, path, result)
+}
+
+// newRequest returns a request for path on the forum with body
+// marshalled as JSON, if not nil.
+func (f *Forum) newRequest(verb, path string, body interface{}) (*http.Request, error) {
 	var rbody io.Reader
 	if body != nil {
 		data, err := json.Marshal(body)
 		if err != nil {
-			return fmt.Errorf("internal error: cannot marshal request body: %v", err)
+			return nil, fmt.Errorf("internal error: cannot marshal request body: %v", err)
 		}
 		rbody = bytes.NewReader(data)
 		debugf("%s on %s with %s", verb, path, data)
@@ -615,48 +2314,87 @@ func (f *Forum) do(verb, path string, body, result interface{}) error {
 	}
 	req, err := http.NewRequest(verb, f.baseURL+path, rbody)
 	if err != nil {
-		return fmt.Errorf("cannot create request: %v", err)
+		return nil, fmt.Errorf("cannot create request: %v", err)
 	}
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("API-Username", f.config.Username)
-	req.Header.Add("API-Key", f.config.Key)
-	resp, err := httpClient.Do(req)
+	return req, nil
+}
+
+// taggedResult is a result for send that records the ETag of the response.
+type taggedResult struct {
+	Value interface{}
+	ETag  string
+}
+
+// send performs req on the forum and decodes the JSON response into
+// result. If result is a *[]byte, the raw response is stored in it.
+// If result is a *taggedResult, the response is handled as if its Value
+// was provided, and its ETag is recorded.
+func (f *Forum) send(req *http.Request, path string, result interface{}) error {
+	return f.sendWith(httpClient, req, path, result)
+}
+
+// sendTransfer is like send, but for requests that may take longer
+// than usual to complete. See transferClient.
+func (f *Forum) sendTransfer(req *http.Request, path string, result interface{}) error {
+	ctx, cancel := transferContext()
+	defer cancel()
+	return f.sendWith(transferClient, req.WithContext(ctx), path, result)
+}
+
+func (f *Forum) sendWith(client *http.Client, req *http.Request, path string, result interface{}) error {
+	verb := req.Method
+	if *dryRun && verb != "GET" {
+		return fmt.Errorf("internal error: attempted %s on %s in dry-run mode", verb, path)
+	}
+	if f.config.ReadOnly && verb != "GET" {
+		return fmt.Errorf("forum %s is configured as read-only", f.baseURL)
+	}
+	req.Header.Set("User-Agent", f.userAgent())
+	f.authenticate(req)
+	f.wait()
+	if verb != "GET" && f.writeLimiter != nil {
+		f.writeLimiter.Wait()
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
 	if err != nil {
+		metrics.Request(time.Since(start), 0)
 		return fmt.Errorf("cannot perform request on %s: %v", path, err)
 	}
 	defer resp.Body.Close()
 
 	data, err := ioutil.ReadAll(resp.Body)
+	stats.Request(req.ContentLength + int64(len(data)))
+	metrics.Request(time.Since(start), resp.StatusCode)
 	if err != nil {
 		return fmt.Errorf("cannot read response (status %d): %v", resp.StatusCode, err)
 	}
 
 	debugf("Got response %d with %s", resp.StatusCode, data)
 
-	switch resp.StatusCode {
-	case 200:
-		// ok
-	case 401, 404:
-		return &NotFoundError{fmt.Sprintf("resource not found: %s", path)}
-	case 409:
-		return fmt.Errorf("someone else edited the same content meanwhile")
-	default:
-		msg := fmt.Sprintf("got %v status", resp.StatusCode)
+	if resp.Header.Get("Discourse-Readonly") == "true" {
+		f.readOnlyMode = true
+	}
 
-		var result struct {
-			Errors    []string `json:"errors"`
-			ErrorType string   `json:"error_type"`
-		}
-		err = json.Unmarshal(data, &result)
-		if err == nil && len(result.Errors) > 0 {
-			msg = result.Errors[0]
-		} else {
-			msg = fmt.Sprintf("got %d status", resp.StatusCode)
-		}
-		return fmt.Errorf("cannot perform request: %s", msg)
+	if resp.StatusCode == 304 && req.Header.Get("If-None-Match") != "" {
+		return errNotModified
+	}
+	err = discourse.CheckResponse(resp, data, path)
+	if isConflict(err) {
+		journal.Record("conflict", verb+" "+path)
+	}
+	if err != nil {
+		return err
 	}
 
-	if result != nil {
+	if tagged, ok := result.(*taggedResult); ok {
+		tagged.ETag = resp.Header.Get("ETag")
+		result = tagged.Value
+	}
+	if raw, ok := result.(*[]byte); ok {
+		*raw = data
+	} else if result != nil {
 		err = json.Unmarshal(data, result)
 		if err != nil {
 			return fmt.Errorf("cannot decode response from %s: %v", path, err)
@@ -666,21 +2404,125 @@ func (f *Forum) do(verb, path string, body, result interface{}) error {
 
 }
 
-type NotFoundError struct {
-	Message string
+// CheckWritable returns an error if changes cannot be saved to the forum.
+func (f *Forum) CheckWritable() error {
+	if f.config.ReadOnly && !*dryRun {
+		return fmt.Errorf("forum %s is configured as read-only in %s", f.baseURL, configPath)
+	}
+	if f.config.ScopedKey {
+		return f.RequireVersion("scoped API keys", "2.6.0")
+	}
+	return nil
+}
+
+// denyDrafts stops using drafts after the forum refused them with err,
+// as happens with API keys scoped to topics only.
+func (f *Forum) denyDrafts(err error) {
+	f.noDrafts = true
+	logf("WARNING: Forum refused access to drafts, so continuing without them (%v).", err)
+}
+
+// wait blocks as necessary to respect the forum rate limit.
+func (f *Forum) wait() {
+	if f.limiter != nil {
+		f.limiter.Wait()
+	}
+}
+
+func (f *Forum) userAgent() string {
+	if f.config.UserAgent != "" {
+		return f.config.UserAgent
+	}
+	return "discedit/" + version
 }
 
-func (e *NotFoundError) Error() string {
-	return e.Message
+func (f *Forum) authenticate(req *http.Request) {
+	for name, value := range f.config.Headers {
+		req.Header.Set(name, value)
+	}
+	if f.config.UserAPIKey != "" {
+		req.Header.Add("User-Api-Key", f.config.UserAPIKey)
+		if f.config.UserAPIClientID != "" {
+			req.Header.Add("User-Api-Client-Id", f.config.UserAPIClientID)
+		}
+		return
+	}
+	req.Header.Add("API-Username", f.config.Username)
+	req.Header.Add("API-Key", f.config.Key)
 }
 
-func isNotFound(err error) bool {
-	_, ok := err.(*NotFoundError)
-	return ok
+// download fetches the content at fileURL, which may be hosted
+// outside the forum (e.g. in a CDN). Credentials are only sent
+// to the forum itself.
+func (f *Forum) download(fileURL string) (data []byte, contentType string, err error) {
+	debugf("GET on %s", fileURL)
+	ctx, cancel := transferContext()
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("User-Agent", f.userAgent())
+	if strings.HasPrefix(fileURL, f.baseURL+"/") {
+		f.authenticate(req)
+		f.wait()
+	}
+	resp, err := transferClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot download %s: %v", fileURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, "", fmt.Errorf("cannot download %s: got %d status", fileURL, resp.StatusCode)
+	}
+	data, err = ioutil.ReadAll(resp.Body)
+	stats.Request(int64(len(data)))
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot download %s: %v", fileURL, err)
+	}
+	debugf("Got %d bytes from %s", len(data), fileURL)
+	return data, resp.Header.Get("Content-Type"), nil
 }
 
 var quietMode = false
 
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// readLine prompts the user and returns the line typed in response,
+// without surrounding spaces.
+func readLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// confirm asks the user a yes/no question, defaulting to no.
+func confirm(question string) bool {
+	answer, err := readLine(question + " [y/N] ")
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes"
+}
+
+// showDiff prints the changes between the old and new texts
+// to the standard output, unless in quiet mode.
+func showDiff(oldText, newText string) {
+	if quietMode {
+		return
+	}
+	diff := unifiedDiff("old", "new", oldText, newText)
+	if diff == "" {
+		diff = "(no changes)\n"
+	}
+	fmt.Print(diff)
+}
+
 func logf(format string, args ...interface{}) {
 	if !quietMode {
 		log.Printf(format, args...)
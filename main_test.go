@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCategoryTopicID(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		topicURL string
+		topicID  int
+	}{
+		{"https://example.com", "/t/about-docs/12", 12},
+		{"https://example.com/forum", "/forum/t/about-docs/12", 12},
+		{"https://example.com/forum", "https://example.com/forum/t/about-docs/12", 12},
+	}
+	for _, test := range tests {
+		forum := &Forum{baseURL: test.baseURL}
+		topicID, err := forum.categoryTopicID(&Category{TopicURL: test.topicURL})
+		if err != nil {
+			t.Errorf("%s with %s: %v", test.topicURL, test.baseURL, err)
+			continue
+		}
+		if topicID != test.topicID {
+			t.Errorf("%s with %s: got topic %d, want %d", test.topicURL, test.baseURL, topicID, test.topicID)
+		}
+	}
+}
+
+func TestReadConfigLayers(t *testing.T) {
+	home := t.TempDir()
+	repo := filepath.Join(t.TempDir(), "repo")
+	subdir := filepath.Join(repo, "docs")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldSystem, oldConfig := systemConfigPath, configPath
+	systemConfigPath = filepath.Join(home, "system.yaml")
+	configPath = filepath.Join(home, "discedit")
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(subdir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		systemConfigPath, configPath = oldSystem, oldConfig
+		os.Chdir(oldDir)
+	})
+	localPath := filepath.Join(repo, localConfigName)
+
+	tests := []struct {
+		summary string
+		system  string
+		user    string
+		local   string
+		err     string
+	}{{
+		summary: "Forum from the repository with credentials from the user",
+		user:    "forums: {https://example.com: {username: joe, key: secret}}",
+		local:   "forums: {https://example.com: {alias: ex, mirrors: [docs]}}",
+	}, {
+		summary: "Missing credentials",
+		system:  "forums: {https://example.com: {rate_limit: 10}}",
+		local:   "forums: {https://example.com: {alias: ex}}",
+		err:     "no username or key for forum https://example.com in $SYSTEM, $LOCAL",
+	}, {
+		summary: "Invalid alias",
+		user:    "forums: {https://example.com: {username: joe, key: secret}}",
+		local:   "forums: {https://example.com: {alias: \"ex:1\"}}",
+		err:     `$LOCAL has invalid alias "ex:1" for forum https://example.com`,
+	}, {
+		summary: "Invalid conflict policy",
+		system:  "forums: {https://example.com: {conflict: bogus}}",
+		user:    "forums: {https://example.com: {username: joe, key: secret}}",
+		err:     `$SYSTEM has invalid conflict policy "bogus" for forum https://example.com`,
+	}, {
+		summary: "Duplicate alias across files",
+		user:    "forums: {https://one.example.com: {username: joe, key: secret, alias: ex}}",
+		local:   "forums: {https://two.example.com: {username: joe, key: secret, alias: ex}}",
+		err:     `alias "ex" for both`,
+	}, {
+		summary: "Repository file running commands",
+		user:    "forums: {https://example.com: {username: joe, key: secret}}",
+		local:   "forums: {https://example.com: {on_publish: make}}",
+		err:     "$LOCAL cannot set on_publish for forum https://example.com, as it was found in the current directory or its parents",
+	}, {
+		summary: "Repository file setting headers",
+		user:    "forums: {https://example.com: {username: joe, key: secret}}",
+		local:   "forums: {https://example.com: {headers: {X-Token: stolen}}}",
+		err:     "$LOCAL cannot set headers for forum https://example.com, as it was found in the current directory or its parents",
+	}, {
+		summary: "Repository file including others",
+		user:    "forums: {https://example.com: {username: joe, key: secret}}",
+		local:   "include: [~/.discedit.d/*.yaml]",
+		err:     "$LOCAL cannot include other files, as it was found in the current directory or its parents",
+	}, {
+		summary: "User file running commands",
+		user:    "forums: {https://example.com: {username: joe, key: secret, on_publish: make}}",
+	}}
+
+	for _, test := range tests {
+		for path, content := range map[string]string{systemConfigPath: test.system, configPath: test.user, localPath: test.local} {
+			os.Remove(path)
+			if content == "" {
+				continue
+			}
+			if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := readConfig()
+		want := strings.NewReplacer("$SYSTEM", systemConfigPath, "$LOCAL", localPath).Replace(test.err)
+		if test.err == "" && err != nil {
+			t.Errorf("%s:\nunexpected error: %v", test.summary, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("%s:\ngot error %v\nwant %q", test.summary, err, want)
+		}
+	}
+}
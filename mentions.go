@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mentionCacheAge is how long the existence of mentioned users is cached.
+const mentionCacheAge = 7 * 24 * time.Hour
+
+// Mentionable reports whether name is a user or group that may be
+// @mentioned on the forum. Names found are cached, so that only new
+// mentions need to be verified on every run.
+func (f *Forum) Mentionable(name string) (bool, error) {
+	key := f.baseURL + " mention " + strings.ToLower(name)
+	var found bool
+	if cacheGet(key, mentionCacheAge, &found) && found {
+		return true, nil
+	}
+	for _, path := range []string{"/u/", "/groups/"} {
+		err := f.do("GET", path+url.PathEscape(name)+".json", nil, nil)
+		if err == nil {
+			found = true
+			break
+		}
+		if !isNotFound(err) {
+			return false, err
+		}
+	}
+	if found {
+		err := cacheSet(key, found)
+		if err != nil {
+			debugf("Cannot cache mention: %v", err)
+		}
+	}
+	return found, nil
+}
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@/.-])@([\w.-]*\w)`)
+
+// checkMentions returns a warning for each distinct @mention in text
+// that refers to no user or group in the forum, as nobody would be
+// notified about it.
+func checkMentions(forum *Forum, text string) []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(withoutCode(text), -1) {
+		name := m[1]
+		if seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		found, err := forum.Mentionable(name)
+		if err != nil {
+			debugf("Cannot verify mention of @%s: %v", name, err)
+			continue
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("mentioned user or group @%s does not exist", name))
+		}
+	}
+	return problems
+}
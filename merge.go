@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+)
+
+// mergeChunk is a region of a three-way merge. Stable chunks hold lines
+// unchanged on both sides. Other chunks hold what each side has in place
+// of the base lines, and are conflicts when both sides changed them
+// differently.
+type mergeChunk struct {
+	Stable   bool
+	Base     []string
+	Ours     []string
+	Theirs   []string
+	Conflict bool
+}
+
+// Result returns the lines that the chunk merges into, or nil with
+// ok set to false if the chunk is a conflict.
+func (c *mergeChunk) Result() (lines []string, ok bool) {
+	switch {
+	case c.Stable || sameLines(c.Theirs, c.Base):
+		return c.Ours, true
+	case sameLines(c.Ours, c.Base) || sameLines(c.Ours, c.Theirs):
+		return c.Theirs, true
+	}
+	return nil, false
+}
+
+func sameLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// baseMatches returns, for each line in base, the index of the same
+// line in other according to their diff, or -1 if it was removed.
+func baseMatches(base, other []string) []int {
+	matches := make([]int, len(base))
+	i, j := 0, 0
+	for _, e := range diffLines(base, other) {
+		switch e.Op {
+		case ' ':
+			matches[i] = j
+			i++
+			j++
+		case '-':
+			matches[i] = -1
+			i++
+		case '+':
+			j++
+		}
+	}
+	return matches
+}
+
+// mergeChunks splits the three-way merge of ours and theirs, both
+// derived from base, into chunks as described in mergeChunk.
+func mergeChunks(base, ours, theirs string) []*mergeChunk {
+	b, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	mo, mt := baseMatches(b, o), baseMatches(b, t)
+
+	var chunks []*mergeChunk
+	var stable *mergeChunk
+	i0, o0, t0 := 0, 0, 0
+	for i := 0; i <= len(b); i++ {
+		oi, ti := len(o), len(t)
+		if i < len(b) {
+			oi, ti = mo[i], mt[i]
+			if oi < 0 || ti < 0 {
+				continue
+			}
+		}
+		if i > i0 || oi > o0 || ti > t0 {
+			chunk := &mergeChunk{Base: b[i0:i], Ours: o[o0:oi], Theirs: t[t0:ti]}
+			_, ok := chunk.Result()
+			chunk.Conflict = !ok
+			chunks = append(chunks, chunk)
+			stable = nil
+		}
+		if i == len(b) {
+			break
+		}
+		if stable == nil {
+			stable = &mergeChunk{Stable: true}
+			chunks = append(chunks, stable)
+		}
+		stable.Base = append(stable.Base, b[i])
+		stable.Ours = append(stable.Ours, o[oi])
+		stable.Theirs = append(stable.Theirs, t[ti])
+		i0, o0, t0 = i+1, oi+1, ti+1
+	}
+	return chunks
+}
+
+// conflictMarker starts regions of conflicting changes in merged content.
+const conflictMarker = "<<<<<<< yours"
+
+// merge3 merges the changes made in ours and theirs to base. Regions
+// changed differently on both sides are included with conflict markers,
+// and counted in conflicts.
+func merge3(base, ours, theirs string) (merged string, conflicts int) {
+	var lines []string
+	for _, chunk := range mergeChunks(base, ours, theirs) {
+		if result, ok := chunk.Result(); ok {
+			lines = append(lines, result...)
+			continue
+		}
+		conflicts++
+		lines = append(lines, conflictMarker)
+		lines = append(lines, chunk.Ours...)
+		lines = append(lines, "=======")
+		lines = append(lines, chunk.Theirs...)
+		lines = append(lines, ">>>>>>> forum")
+	}
+	return strings.Join(lines, "\n"), conflicts
+}
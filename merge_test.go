@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		summary   string
+		base      string
+		ours      string
+		theirs    string
+		merged    string
+		conflicts int
+	}{{
+		summary: "Separate edits",
+		base:    "a\nb\nc\nd\ne",
+		ours:    "a\nB\nc\nd\ne",
+		theirs:  "a\nb\nc\nD\ne",
+		merged:  "a\nB\nc\nD\ne",
+	}, {
+		// As with diff3 and git, edits to adjacent lines are not
+		// known to be independent, so they conflict.
+		summary:   "Adjacent edits",
+		base:      "a\nb\nc\nd",
+		ours:      "a\nB\nc\nd",
+		theirs:    "a\nb\nC\nd",
+		merged:    "a\n<<<<<<< yours\nB\nc\n=======\nb\nC\n>>>>>>> forum\nd",
+		conflicts: 1,
+	}, {
+		summary: "Insertions at start and end",
+		base:    "a\nb",
+		ours:    "x\na\nb",
+		theirs:  "a\nb\ny",
+		merged:  "x\na\nb\ny",
+	}, {
+		summary:   "Insertions at the same place",
+		base:      "a\nb",
+		ours:      "a\nx\nb",
+		theirs:    "a\ny\nb",
+		merged:    "a\n<<<<<<< yours\nx\n=======\ny\n>>>>>>> forum\nb",
+		conflicts: 1,
+	}, {
+		summary:   "Delete versus edit",
+		base:      "a\nb\nc",
+		ours:      "a\nc",
+		theirs:    "a\nB\nc",
+		merged:    "a\n<<<<<<< yours\n=======\nB\n>>>>>>> forum\nc",
+		conflicts: 1,
+	}, {
+		summary: "Delete on one side only",
+		base:    "a\nb\nc\nd\ne",
+		ours:    "a\nc\nd\ne",
+		theirs:  "a\nb\nc\nd\nE",
+		merged:  "a\nc\nd\nE",
+	}, {
+		summary: "Empty base with one side written",
+		base:    "",
+		ours:    "x",
+		theirs:  "",
+		merged:  "x",
+	}, {
+		summary:   "Empty base with both sides written",
+		base:      "",
+		ours:      "x",
+		theirs:    "y",
+		merged:    "<<<<<<< yours\nx\n=======\ny\n>>>>>>> forum",
+		conflicts: 1,
+	}, {
+		summary: "Identical changes on both sides",
+		base:    "a\nb\nc",
+		ours:    "a\nB\nc",
+		theirs:  "a\nB\nc",
+		merged:  "a\nB\nc",
+	}, {
+		summary: "Identical deletions on both sides",
+		base:    "a\nb\nc",
+		ours:    "a\nc",
+		theirs:  "a\nc",
+		merged:  "a\nc",
+	}, {
+		summary: "No changes",
+		base:    "a\nb",
+		ours:    "a\nb",
+		theirs:  "a\nb",
+		merged:  "a\nb",
+	}}
+	for _, test := range tests {
+		merged, conflicts := merge3(test.base, test.ours, test.theirs)
+		if merged != test.merged || conflicts != test.conflicts {
+			t.Errorf("%s:\nmerged:    %q (%d conflicts)\nwant:      %q (%d conflicts)",
+				test.summary, merged, conflicts, test.merged, test.conflicts)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// runMessages lists the messages in a group inbox, such as the one of
+// @moderators, and lets the user pick them for editing.
+func runMessages(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("messages command expects a single forum URL")
+	}
+	if *group == "" {
+		return fmt.Errorf("messages command requires the -group option")
+	}
+	baseURL, err := parseForumURL(config.expandAlias(args[0]))
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, baseURL)
+	if err != nil {
+		return err
+	}
+	topics, err := forum.LoadGroupMessages(*group)
+	if err != nil {
+		return err
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("group %s has no messages", *group)
+	}
+	return pickTopics(forum, topics)
+}
+
+// LoadGroupMessages returns the messages in the inbox of the named
+// group, which the current user must be a member of.
+func (f *Forum) LoadGroupMessages(group string) ([]*Topic, error) {
+	username, err := f.CurrentUsername()
+	if err != nil {
+		return nil, err
+	}
+
+	logf("Loading messages of group %s...", group)
+
+	var result struct {
+		TopicList struct {
+			Topics []*Topic `json:"topics"`
+		} `json:"topic_list"`
+	}
+	path := "/topics/private-messages-group/" + url.PathEscape(username) + "/" + url.PathEscape(group) + ".json"
+	err = f.do("GET", path, nil, &result)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("cannot find messages of group %s: group missing or %s is not a member", group, username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.TopicList.Topics, nil
+}
+
+// runCompose writes a new personal message in the editor and sends it
+// to the users and groups provided via -to.
+func runCompose(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("compose command expects a single forum URL")
+	}
+	if *recipients == "" || *composeTitle == "" {
+		return fmt.Errorf("compose command requires the -to and -title options")
+	}
+	baseURL, err := parseForumURL(config.expandAlias(args[0]))
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, baseURL)
+	if err != nil {
+		return err
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	raw, err := composeText("")
+	if err != nil || raw == "" {
+		return err
+	}
+
+	if *dryRun {
+		logf("Dry run: not sending message %q to %s. Content would be:", *composeTitle, *recipients)
+		showDiff("", raw)
+		return nil
+	}
+
+	logf("Sending message %q to %s...", *composeTitle, *recipients)
+	post, err := forum.CreatePost(map[string]interface{}{
+		"title":             *composeTitle,
+		"raw":               raw,
+		"archetype":         "private_message",
+		"target_recipients": *recipients,
+	})
+	if err != nil {
+		return err
+	}
+	logf("Sent message: %s/t/%s/%d", forum.baseURL, post.TopicSlug, post.TopicID)
+	return nil
+}
+
+// composeText opens the editor with the initial text for writing new
+// content, and returns the written content, or an empty string if
+// nothing was written. The content is kept in the local backup if it
+// cannot be used.
+func composeText(initial string) (string, error) {
+	filename, err := createTempFile(initial)
+	if err != nil {
+		return "", err
+	}
+	logf("Opening your preferred editor...")
+	err = runEditor(filename)
+	if err != nil {
+		os.Remove(filename)
+		return "", err
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		os.Remove(filename)
+		return "", fmt.Errorf("cannot read edited content at %s: %v", filename, err)
+	}
+	raw := strings.TrimSpace(string(content))
+	if raw == "" || raw == strings.TrimSpace(initial) {
+		os.Remove(filename)
+		logf("No content written, aborting.")
+		return "", nil
+	}
+	renameToLast(filename)
+	return raw, nil
+}
+
+// CreatePost creates a new post, topic, or personal message with the
+// provided parameters, and returns the created post.
+func (f *Forum) CreatePost(params map[string]interface{}) (*Post, error) {
+	var post Post
+	err := f.do("POST", "/posts.json", params, &post)
+	if err != nil {
+		return nil, err
+	}
+	if post.ID == 0 {
+		return nil, fmt.Errorf("internal error: creating post returned no post data")
+	}
+	post.Raw = fmt.Sprint(params["raw"])
+	return &post, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TopicMeta holds the details reported by the meta command. LastEditor
+// and LastEdited are empty, and Draft is nil, when they cannot be found
+// out, such as when the forum refuses access to them.
+type TopicMeta struct {
+	ID         int        `json:"id"`
+	URL        string     `json:"url"`
+	Title      string     `json:"title"`
+	Category   string     `json:"category"`
+	Tags       []string   `json:"tags"`
+	Words      int        `json:"words"`
+	LastEditor string     `json:"last_editor"`
+	LastEdited *time.Time `json:"last_edited"`
+	Revisions  int        `json:"revisions"`
+	Draft      *bool      `json:"draft"`
+	SlowMode   int        `json:"slow_mode_seconds"`
+}
+
+func runMeta(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("meta command expects a single topic URL")
+	}
+	forum, topicID, postNumber, err := openPost(config, args[0])
+	if err != nil {
+		return err
+	}
+	topic, err := forum.LoadTopicPost(topicID, postNumber)
+	if err != nil {
+		return err
+	}
+	var draft *bool
+	err = forum.LoadDraft(topic)
+	if err == nil || isNotFound(err) {
+		if !forum.noDrafts {
+			hasDraft := topic.Draft != nil
+			draft = &hasDraft
+		}
+	} else {
+		logf("WARNING: Cannot find out whether there is a draft: %v", err)
+	}
+	var lastEdited *time.Time
+	editor, edited, err := forum.LastEdit(topic.Post)
+	if isUnauthorized(err) && forum.config.ScopedKey {
+		// Revisions are not covered by topic scopes.
+		editor, edited = topic.Post.Username, topic.Post.UpdatedAt
+		err = nil
+	}
+	if err == nil {
+		lastEdited = &edited
+	} else {
+		logf("WARNING: %v", err)
+		editor = ""
+	}
+
+	meta := &TopicMeta{
+		ID:         topic.ID,
+		URL:        topic.ForumURL(forum),
+		Title:      topic.Title,
+		Category:   strconv.Itoa(topic.Category),
+		Tags:       topic.Tags,
+		Words:      len(strings.Fields(topic.Post.Raw)),
+		LastEditor: editor,
+		LastEdited: lastEdited,
+		Revisions:  topic.Post.Version - 1,
+		Draft:      draft,
+		SlowMode:   int(topic.SlowMode(time.Now()) / time.Second),
+	}
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+	if site, err := forum.Site(); err == nil {
+		if c := site.Category(topic.Category); c != nil {
+			meta.Category = c.Name
+		}
+	}
+
+	filename := *outputPath
+	if filename == "" {
+		filename = "-"
+	}
+	return writeOutput(filename, func(w io.Writer) error {
+		if *jsonOutput {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "\t")
+			return encoder.Encode(meta)
+		}
+		draft := "unknown"
+		if meta.Draft != nil && *meta.Draft {
+			draft = "yes"
+		} else if meta.Draft != nil {
+			draft = "no"
+		}
+		lastEditor := "unknown"
+		if meta.LastEdited != nil {
+			lastEditor = fmt.Sprintf("%s (%s)", meta.LastEditor, meta.LastEdited.Local().Format("2006-01-02 15:04 MST"))
+		}
+		slowMode := "off"
+		if meta.SlowMode > 0 {
+			slowMode = fmt.Sprintf("one reply every %v", time.Duration(meta.SlowMode)*time.Second)
+		}
+		_, err := fmt.Fprintf(w, "Title:       %s\n"+
+			"URL:         %s\n"+
+			"Category:    %s\n"+
+			"Tags:        %s\n"+
+			"Words:       %d\n"+
+			"Last editor: %s\n"+
+			"Revisions:   %d\n"+
+			"Draft:       %s\n"+
+			"Slow mode:   %s\n",
+			meta.Title, meta.URL, meta.Category, strings.Join(meta.Tags, ", "), meta.Words,
+			lastEditor, meta.Revisions, draft, slowMode)
+		return err
+	})
+}
+
+// LastEdit returns who last edited the post and when. Posts that were
+// never edited report their author and creation time.
+func (f *Forum) LastEdit(post *Post) (username string, at time.Time, err error) {
+	if post.Version <= 1 {
+		return post.Username, post.CreatedAt, nil
+	}
+	var result struct {
+		Username  string    `json:"username"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	err = f.do("GET", "/posts/"+strconv.Itoa(post.ID)+"/revisions/latest.json", nil, &result)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot find out last editor of post %d: %v", post.ID, err)
+	}
+	return result.Username, result.CreatedAt, nil
+}
+
+// checkLastEdit reports who last edited the post and how long ago.
+// With -confirm-recent, editing a post that someone else changed
+// within that time must be confirmed.
+func checkLastEdit(forum *Forum, post *Post) error {
+	editor, edited, err := forum.LastEdit(post)
+	if isUnauthorized(err) && forum.config.ScopedKey {
+		debugf("%v", err)
+		return nil
+	}
+	if err != nil {
+		logf("WARNING: %v", err)
+		return nil
+	}
+	age := time.Since(edited)
+	logf("Last edited by %s %s.", editor, formatAge(age))
+
+	if *confirmRecent <= 0 || age >= *confirmRecent {
+		return nil
+	}
+	username, err := forum.CurrentUsername()
+	if err != nil {
+		return err
+	}
+	if editor != username && !confirm(fmt.Sprintf("Post was changed by %s %s. Edit anyway?", editor, formatAge(age))) {
+		return fmt.Errorf("post was recently changed by %s", editor)
+	}
+	return nil
+}
+
+// formatAge returns a rough description of how long ago something
+// happened, such as "5 minutes ago".
+func formatAge(age time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return plural(int(age/time.Minute), "minute")
+	case age < 24*time.Hour:
+		return plural(int(age/time.Hour), "hour")
+	}
+	return plural(int(age/(24*time.Hour)), "day")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// runMetrics tracks counters of a long-running discedit process, such
+// as while live editing or mirroring large categories, so they can be
+// scraped by Prometheus from the address given with -metrics.
+type runMetrics struct {
+	mu             sync.Mutex
+	requests       int
+	requestSeconds float64
+	apiErrors      int
+	conflicts      int
+	postsSaved     int
+	topicsMirrored int
+}
+
+var metrics = &runMetrics{}
+
+// Request records a request to the forum that took d to complete and
+// got the given status, or 0 if no response was received at all.
+func (m *runMetrics) Request(d time.Duration, status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+	m.requestSeconds += d.Seconds()
+	if status != 200 {
+		m.apiErrors++
+	}
+	if status == 409 {
+		m.conflicts++
+	}
+}
+
+// PostSaved records that a post was saved to the forum.
+func (m *runMetrics) PostSaved() {
+	m.mu.Lock()
+	m.postsSaved++
+	m.mu.Unlock()
+}
+
+// TopicMirrored records that a topic was mirrored from the forum.
+func (m *runMetrics) TopicMirrored() {
+	m.mu.Lock()
+	m.topicsMirrored++
+	m.mu.Unlock()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *runMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+	metric("discedit_posts_saved_total", "counter", "Posts saved to the forum.", m.postsSaved)
+	metric("discedit_topics_mirrored_total", "counter", "Topics mirrored from the forum.", m.topicsMirrored)
+	metric("discedit_conflicts_total", "counter", "Saves rejected because someone else changed the content meanwhile.", m.conflicts)
+	metric("discedit_api_errors_total", "counter", "Requests to the forum that failed or got an unexpected status.", m.apiErrors)
+	fmt.Fprintf(w, "# HELP discedit_request_duration_seconds Time taken by requests to the forum.\n"+
+		"# TYPE discedit_request_duration_seconds summary\n"+
+		"discedit_request_duration_seconds_sum %v\n"+
+		"discedit_request_duration_seconds_count %d\n", m.requestSeconds, m.requests)
+}
+
+// serveMetrics serves the metrics at /metrics on addr in the background
+// for as long as discedit runs.
+func serveMetrics(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot serve metrics: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go func() {
+		err := http.Serve(l, mux)
+		logf("WARNING: Stopped serving metrics: %v", err)
+	}()
+	debugf("Serving metrics on http://%s/metrics", l.Addr())
+	return nil
+}
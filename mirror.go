@@ -0,0 +1,489 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A mirror is a local directory holding the first post of every
+// topic in a category as a markdown file, along with an index that
+// records where each file came from and the state it was in.
+
+const mirrorIndexName = ".discedit-mirror.yaml"
+
+type Mirror struct {
+	Forum    string         `yaml:"forum"`
+	Category string         `yaml:"category,omitempty"`
+	Topics   []*MirrorTopic `yaml:"topics"`
+
+	dir string
+}
+
+type MirrorTopic struct {
+	File    string `yaml:"file"`
+	Title   string `yaml:"title"`
+	TopicID int    `yaml:"topic"`
+	PostID  int    `yaml:"post"`
+
+	// Version is the post version when it was last mirrored.
+	Version int `yaml:"version"`
+
+	// Hash is the SHA-256 of the file content when it was last mirrored.
+	Hash string `yaml:"hash"`
+
+	// ETag is the ETag the forum sent for the post while at Version,
+	// so that the status command may check for changes without loading
+	// the post again. It is empty if not known.
+	ETag string `yaml:"etag,omitempty"`
+}
+
+func readMirror(dir string) (*Mirror, error) {
+	path := filepath.Join(dir, mirrorIndexName)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s is not a mirror: missing %s", dir, mirrorIndexName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read mirror index: %v", err)
+	}
+	var mirror Mirror
+	err = yaml.Unmarshal(data, &mirror)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal %s: %v", path, err)
+	}
+	mirror.dir = dir
+	return &mirror, nil
+}
+
+func (m *Mirror) write() error {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("internal error: cannot marshal mirror index: %v", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(m.dir, mirrorIndexName), data, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot write mirror index: %v", err)
+	}
+	return nil
+}
+
+// Topic returns the mirrored topic with the given ID, or nil.
+func (m *Mirror) Topic(topicID int) *MirrorTopic {
+	for _, mtopic := range m.Topics {
+		if mtopic.TopicID == topicID {
+			return mtopic
+		}
+	}
+	return nil
+}
+
+// LocalChange reports whether the file of the mirrored topic was
+// changed since it was mirrored, and whether it is missing.
+func (m *Mirror) LocalChange(mtopic *MirrorTopic) (changed, missing bool, err error) {
+	data, err := ioutil.ReadFile(filepath.Join(m.dir, mtopic.File))
+	if os.IsNotExist(err) {
+		return true, true, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("cannot read mirrored file: %v", err)
+	}
+	return contentHash(data) != mtopic.Hash, false, nil
+}
+
+// RemoteChange reports whether the post of the mirrored topic was
+// changed in the forum since it was mirrored, and whether it was deleted.
+// A conditional request is sent when the ETag of the post is known, so
+// that the post is only transferred when it changed. If the post is
+// unchanged and its ETag was not known, it is recorded in mtopic.
+func (m *Mirror) RemoteChange(forum *Forum, mtopic *MirrorTopic) (changed, deleted bool, err error) {
+	post, etag, err := forum.LoadPostIfChanged(mtopic.PostID, mtopic.ETag)
+	if isNotFound(err) {
+		return false, true, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	if post == nil {
+		return false, false, nil
+	}
+	if post.Version != mtopic.Version {
+		return true, false, nil
+	}
+	mtopic.ETag = etag
+	return false, false, nil
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func runMirror(config *Config, args []string) error {
+	if len(args) > 0 && args[0] == "status" {
+		return runMirrorStatus(config, subcommandArgs(args[1:]))
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("mirror command expects a category URL and a directory")
+	}
+	forum, categoryPath, err := openCategory(config, args[:1])
+	if err != nil {
+		return err
+	}
+	err = checkCategoryAccess(forum, categoryPath)
+	if err != nil {
+		return err
+	}
+	return mirrorCategory(forum, categoryPath, args[1])
+}
+
+// dumpCategory runs the mirror command for -dump-category, which may
+// be given just a category slug when a single forum is configured.
+func dumpCategory(config *Config, category string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("-dump-category expects a single directory")
+	}
+	category = config.expandAlias(category)
+	if !categoryURLPattern.MatchString(category) {
+		if len(config.Forums) != 1 {
+			return fmt.Errorf("-dump-category needs a category URL when more than one forum is configured")
+		}
+		for baseURL := range config.Forums {
+			category = baseURL + "/c/" + strings.Trim(category, "/")
+		}
+	}
+	return runMirror(config, []string{category, args[0]})
+}
+
+// mirrorCategory downloads the first post of every topic in the
+// category into dir. Files changed locally since they were last
+// mirrored are left alone.
+func mirrorCategory(forum *Forum, categoryPath, dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create mirror directory: %v", err)
+	}
+	var mirror *Mirror
+	if _, err := os.Stat(filepath.Join(dir, mirrorIndexName)); os.IsNotExist(err) {
+		mirror = &Mirror{Forum: forum.baseURL, Category: categoryPath, dir: dir}
+	} else if mirror, err = readMirror(dir); err != nil {
+		return err
+	}
+	if mirror.Forum != forum.baseURL {
+		return fmt.Errorf("%s mirrors forum %s, not %s", dir, mirror.Forum, forum.baseURL)
+	}
+
+	stats.Phase("list")
+	var topics []*Topic
+	var subdirs map[int]string
+	if *recurse {
+		topics, subdirs, err = loadCategoryTree(forum, categoryPath)
+	} else {
+		topics, err = forum.LoadCategoryTopics(categoryPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	stats.Phase("mirror")
+	progress := newProgress(len(topics))
+	for _, topic := range topics {
+		progress.Start(topic.Title)
+		mtopic := mirror.Topic(topic.ID)
+		if mtopic != nil {
+			changed, missing, err := mirror.LocalChange(mtopic)
+			if err != nil {
+				progress.Failed(err)
+				continue
+			}
+			if changed && !missing {
+				progress.Skipped("changed locally")
+				continue
+			}
+		}
+		post, err := forum.LoadPostByNumber(topic.ID, 1)
+		if err != nil {
+			progress.Failed(err)
+			continue
+		}
+		if mtopic != nil && mtopic.Version == post.Version {
+			if _, missing, _ := mirror.LocalChange(mtopic); !missing {
+				progress.Skipped("unchanged")
+				continue
+			}
+		}
+		if mtopic == nil {
+			mtopic = &MirrorTopic{
+				File:    path.Join(subdirs[topic.Category], fmt.Sprintf("%s-%d.md", topic.Slug, topic.ID)),
+				TopicID: topic.ID,
+			}
+			mirror.Topics = append(mirror.Topics, mtopic)
+		}
+		data := []byte(post.Raw + "\n")
+		filename := filepath.Join(dir, filepath.FromSlash(mtopic.File))
+		err = os.MkdirAll(filepath.Dir(filename), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filename, data, 0644)
+		}
+		if err != nil {
+			progress.Failed(fmt.Errorf("cannot write mirrored file: %v", err))
+			continue
+		}
+		mtopic.Title = topic.Title
+		mtopic.PostID = post.ID
+		mtopic.Version = post.Version
+		mtopic.Hash = contentHash(data)
+		mtopic.ETag = ""
+		metrics.TopicMirrored()
+		progress.Succeeded()
+	}
+
+	err = mirror.write()
+	if err != nil {
+		return err
+	}
+	return progress.Summary()
+}
+
+// loadCategoryTree returns the topics in the category at categoryPath
+// and in all of its subcategories, along with the directory, relative
+// to the mirror, for the topics of each category ID. Subcategories are
+// mirrored into nested directories named after their slugs.
+func loadCategoryTree(forum *Forum, categoryPath string) (topics []*Topic, subdirs map[int]string, err error) {
+	site, err := forum.Site()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot find subcategories: %v", err)
+	}
+	root := site.CategoryByPath(categoryPath)
+	if root == nil {
+		return nil, nil, fmt.Errorf("cannot find subcategories: category %s is not visible", categoryPath)
+	}
+
+	subdirs = map[int]string{root.ID: ""}
+	paths := []string{categoryPath}
+	ids := []int{root.ID}
+	for i := 0; i < len(ids); i++ {
+		for _, c := range site.Categories {
+			if c.ParentCategoryID == ids[i] && c.ID != ids[i] {
+				subdirs[c.ID] = path.Join(subdirs[ids[i]], c.Slug)
+				paths = append(paths, fmt.Sprintf("%s/%d", c.Slug, c.ID))
+				ids = append(ids, c.ID)
+			}
+		}
+	}
+
+	// Listings of a category may include topics of its subcategories,
+	// so the same topic may be seen more than once.
+	seen := make(map[int]bool)
+	for i, p := range paths {
+		listed, err := forum.LoadCategoryTopics(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, topic := range listed {
+			if seen[topic.ID] {
+				continue
+			}
+			seen[topic.ID] = true
+			if _, ok := subdirs[topic.Category]; !ok {
+				topic.Category = ids[i]
+			}
+			topics = append(topics, topic)
+		}
+	}
+	return topics, subdirs, nil
+}
+
+// runMirrorStatus reports which mirrored topics changed locally,
+// remotely, or both, since they were last mirrored.
+func runMirrorStatus(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("mirror status command expects a mirror directory")
+	}
+	mirror, err := readMirror(args[0])
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, mirror.Forum)
+	if err != nil {
+		return err
+	}
+
+	tagged := false
+	for _, mtopic := range mirror.Topics {
+		local, missing, err := mirror.LocalChange(mtopic)
+		if err != nil {
+			return err
+		}
+		etag := mtopic.ETag
+		remote, deleted, err := mirror.RemoteChange(forum, mtopic)
+		tagged = tagged || mtopic.ETag != etag
+		if err != nil {
+			return err
+		}
+		if deleted {
+			fmt.Printf("deleted  %s\n", mtopic.File)
+			continue
+		}
+
+		var status string
+		switch {
+		case missing:
+			status = "missing"
+		case local && remote:
+			status = "both"
+		case local:
+			status = "local"
+		case remote:
+			status = "remote"
+		default:
+			continue
+		}
+		fmt.Printf("%-8s %s\n", status, mtopic.File)
+	}
+
+	if tagged && !*dryRun {
+		err = mirror.write()
+		if err != nil {
+			return err
+		}
+	}
+
+	if mirror.Category != "" {
+		topics, err := forum.LoadCategoryTopics(mirror.Category)
+		if err != nil {
+			return err
+		}
+		for _, topic := range topics {
+			if mirror.Topic(topic.ID) == nil {
+				fmt.Printf("new      %s\n", topic.ForumURL(forum))
+			}
+		}
+	}
+	return nil
+}
+
+// findMirror returns the mirror holding dir, which may be any directory
+// within it, or nil if dir is not within a mirror.
+func findMirror(dir string) (*Mirror, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find mirror: %v", err)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, mirrorIndexName)); err == nil {
+			return readMirror(dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// FileTopic returns the mirrored topic held in the named file, or if
+// filename is empty, the one whose file was most recently modified.
+func (m *Mirror) FileTopic(filename string) (*MirrorTopic, error) {
+	if filename != "" {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, mtopic := range m.Topics {
+			if filepath.Join(m.dir, filepath.FromSlash(mtopic.File)) == abs {
+				return mtopic, nil
+			}
+		}
+		return nil, fmt.Errorf("%s is not a mirrored topic in %s", filename, m.dir)
+	}
+	var latest *MirrorTopic
+	var latestTime time.Time
+	for _, mtopic := range m.Topics {
+		info, err := os.Stat(filepath.Join(m.dir, filepath.FromSlash(mtopic.File)))
+		if err != nil {
+			continue
+		}
+		if latest == nil || info.ModTime().After(latestTime) {
+			latest, latestTime = mtopic, info.ModTime()
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("mirror in %s has no topic files", m.dir)
+	}
+	return latest, nil
+}
+
+// checkMirrored fails if post changed in the forum since it was mirrored
+// into path, as publishing the local file would overwrite those changes.
+func checkMirrored(forum *Forum, post *Post, mtopic *MirrorTopic, path string) error {
+	if post.Version == mtopic.Version {
+		return nil
+	}
+	return fmt.Errorf("topic changed in the forum as well since it was mirrored into %s (merge the local changes by editing %s/t/%d instead)",
+		path, forum.baseURL, mtopic.TopicID)
+}
+
+// editMirrored edits the topic mirrored in the named file, or in the most
+// recently modified file of the mirror holding the current directory if
+// filename is empty. Files changed locally are published as they are, with
+// the mirror index updated so they are not reported as changed anymore,
+// unless the topic changed in the forum as well since it was mirrored.
+func editMirrored(config *Config, mirror *Mirror, filename string) error {
+	mtopic, err := mirror.FileTopic(filename)
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, mirror.Forum)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(mirror.dir, filepath.FromSlash(mtopic.File))
+	changed, missing, err := mirror.LocalChange(mtopic)
+	if err != nil {
+		return err
+	}
+	publish := changed && !missing && *saveFrom == ""
+	if publish {
+		post, err := forum.LoadPost(mtopic.PostID)
+		if err != nil {
+			return err
+		}
+		err = checkMirrored(forum, post, mtopic, path)
+		if err != nil {
+			return err
+		}
+		logf("Publishing %s as %q...", path, mtopic.Title)
+		*saveFrom = path
+	} else {
+		logf("Editing %q, mirrored in %s...", mtopic.Title, path)
+	}
+	err = editTopic(forum, mtopic.TopicID, 1)
+	if err != nil || !publish || *dryRun {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		var post *Post
+		post, err = forum.LoadPost(mtopic.PostID)
+		if err == nil {
+			mtopic.Version = post.Version
+			mtopic.Hash = contentHash(data)
+			mtopic.ETag = ""
+			err = mirror.write()
+		}
+	}
+	if err != nil {
+		logf("WARNING: Cannot update mirror index: %v", err)
+	}
+	return nil
+}
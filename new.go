@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// titlePrefix marks the optional first line of new topics written in
+// the editor that holds the title of the topic.
+const titlePrefix = "Title:"
+
+// createTopic writes a new topic in the editor and posts it to the
+// category provided via -category, printing the URL of the new topic.
+func createTopic(config *Config, forumURL string) error {
+	if *category == "" {
+		return fmt.Errorf("-new requires the -category option")
+	}
+	baseURL, err := parseForumURL(config.expandAlias(forumURL))
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, baseURL)
+	if err != nil {
+		return err
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+	site, err := forum.Site()
+	if err != nil {
+		return fmt.Errorf("cannot find category: %v", err)
+	}
+	c := site.CategoryByPath(*category)
+	if c == nil {
+		return fmt.Errorf("category %s does not exist or is not visible to the configured user", *category)
+	}
+
+	text, err := composeText(titlePrefix + " " + *composeTitle + "\n\n")
+	if err != nil || text == "" {
+		return err
+	}
+	title, raw := splitTitle(text)
+	if title == "" {
+		title = *composeTitle
+	}
+	if title == "" {
+		return fmt.Errorf("new topic has no title (content kept in %s.last.md)", configPath)
+	}
+	if raw == "" {
+		return fmt.Errorf("new topic has no content (content kept in %s.last.md)", configPath)
+	}
+
+	if *dryRun {
+		logf("Dry run: not creating topic %q in %s. Content would be:", title, c.Name)
+		showDiff("", raw)
+		return nil
+	}
+
+	logf("Creating topic %q in %s...", title, c.Name)
+	post, err := forum.CreatePost(map[string]interface{}{
+		"title":    title,
+		"raw":      raw,
+		"category": c.ID,
+	})
+	if err != nil {
+		return err
+	}
+	// Printed even in quiet mode, for scripts to pick up.
+	fmt.Printf("%s/t/%s/%d\n", forum.baseURL, post.TopicSlug, post.TopicID)
+	return nil
+}
+
+// splitTitle splits text written for a new topic into the title on its
+// leading "Title:" line, if any, and the content that follows.
+func splitTitle(text string) (title, raw string) {
+	first, rest := text, ""
+	if i := strings.Index(text, "\n"); i >= 0 {
+		first, rest = text[:i], text[i+1:]
+	}
+	if !strings.HasPrefix(first, titlePrefix) {
+		return "", storedText(text)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(first, titlePrefix)), storedText(rest)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notes are private reminders about topics, such as "don't touch the
+// install section until 2.0 ships", kept locally next to the cache and
+// shown whenever the topic is opened for editing.
+
+type topicNote struct {
+	Text  string    `json:"text"`
+	Added time.Time `json:"added"`
+}
+
+func notesPath() string {
+	return configPath + ".notes"
+}
+
+// notesKey identifies the topic in the notes, independently of its slug.
+func notesKey(forum *Forum, topicID int) string {
+	return forum.baseURL + "/t/" + strconv.Itoa(topicID)
+}
+
+func readNotes() (map[string][]*topicNote, error) {
+	notes := make(map[string][]*topicNote)
+	data, err := ioutil.ReadFile(notesPath())
+	if os.IsNotExist(err) {
+		return notes, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read notes: %v", err)
+	}
+	err = json.Unmarshal(data, &notes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode notes %s: %v", notesPath(), err)
+	}
+	return notes, nil
+}
+
+// updateNotes calls update with all notes and writes them back, holding
+// the notes lock meanwhile.
+func updateNotes(update func(notes map[string][]*topicNote)) error {
+	unlock, err := lockPath(notesPath())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	notes, err := readNotes()
+	if err != nil {
+		return err
+	}
+	update(notes)
+	data, err := json.MarshalIndent(notes, "", "\t")
+	if err != nil {
+		return fmt.Errorf("internal error: cannot marshal notes: %v", err)
+	}
+	err = ioutil.WriteFile(notesPath(), data, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write notes: %v", err)
+	}
+	return nil
+}
+
+// topicNotes returns the notes about the topic, oldest first.
+func topicNotes(forum *Forum, topicID int) ([]*topicNote, error) {
+	unlock, err := lockPath(notesPath())
+	if err != nil {
+		return nil, err
+	}
+	notes, err := readNotes()
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+	return notes[notesKey(forum, topicID)], nil
+}
+
+// showNotes logs the notes about the topic, if any.
+func showNotes(forum *Forum, topic *Topic) {
+	notes, err := topicNotes(forum, topic.ID)
+	if err != nil {
+		logf("WARNING: %v", err)
+		return
+	}
+	for _, note := range notes {
+		logf("NOTE (%s): %s", formatAge(time.Since(note.Added)), note.Text)
+	}
+}
+
+// runNotes adds, lists, and clears the local notes about topics.
+func runNotes(config *Config, args []string) error {
+	if len(args) == 0 {
+		return listAllNotes()
+	}
+	action := args[0]
+	switch action {
+	case "add", "clear":
+		args = subcommandArgs(args[1:])
+	default:
+		action = "list"
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("notes %s expects a forum topic URL", action)
+	}
+	forum, topicID, err := openTopic(config, args[0])
+	if err != nil {
+		return err
+	}
+	key := notesKey(forum, topicID)
+
+	switch action {
+	case "add":
+		text := strings.TrimSpace(strings.Join(args[1:], " "))
+		if text == "" {
+			return fmt.Errorf("notes add expects a forum topic URL and the note text")
+		}
+		return updateNotes(func(notes map[string][]*topicNote) {
+			notes[key] = append(notes[key], &topicNote{Text: text, Added: time.Now()})
+		})
+	case "clear":
+		if len(args) != 1 {
+			return fmt.Errorf("notes clear expects a single forum topic URL")
+		}
+		return updateNotes(func(notes map[string][]*topicNote) {
+			delete(notes, key)
+		})
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("notes command expects a single forum topic URL")
+	}
+	notes, err := topicNotes(forum, topicID)
+	if err != nil {
+		return err
+	}
+	if len(notes) == 0 {
+		logf("No notes about %s.", key)
+	}
+	for _, note := range notes {
+		fmt.Printf("%s  %s\n", note.Added.Local().Format("2006-01-02 15:04"), note.Text)
+	}
+	return nil
+}
+
+func listAllNotes() error {
+	unlock, err := lockPath(notesPath())
+	if err != nil {
+		return err
+	}
+	notes, err := readNotes()
+	unlock()
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for key := range notes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Println(key)
+		for _, note := range notes[key] {
+			fmt.Printf("    %s  %s\n", note.Added.Local().Format("2006-01-02 15:04"), note.Text)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// notificationLevels maps the names accepted by -notify to the
+// notification levels of topics in Discourse.
+var notificationLevels = map[string]int{
+	"muted":    0,
+	"regular":  1,
+	"tracking": 2,
+	"watching": 3,
+}
+
+func checkNotificationLevel(level string) error {
+	if _, ok := notificationLevels[level]; !ok && level != "" {
+		return fmt.Errorf("invalid notification level %q: must be watching, tracking, regular, or muted", level)
+	}
+	return nil
+}
+
+// SetNotificationLevel sets the notification level of the configured
+// user on the topic, such as to watch pages they maintain.
+func (f *Forum) SetNotificationLevel(topic *Topic, level string) error {
+	if *dryRun {
+		logf("Dry run: not setting notification level on %s to %s.", topic, level)
+		return nil
+	}
+
+	logf("Setting notification level on %s to %s...", topic, level)
+
+	body := map[string]interface{}{
+		"notification_level": notificationLevels[level],
+	}
+	err := f.do("POST", "/t/"+strconv.Itoa(topic.ID)+"/notifications", body, nil)
+	if err != nil {
+		return fmt.Errorf("cannot set notification level: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/niemeyer/discedit/shlex"
+)
+
+// runOnPublish runs the on_publish command of the forum, if any, after
+// the topic post was saved with newText in place of oldText. The command
+// gets the topic URL, the topic ID, and the path of a file holding the
+// diff of the change as arguments, and also in the environment as
+// DISCEDIT_TOPIC_URL, DISCEDIT_TOPIC_ID, and DISCEDIT_DIFF, so a save
+// may trigger automation such as cache purges or chat notifications.
+func runOnPublish(forum *Forum, topic *Topic, oldText, newText string) error {
+	command := forum.config.OnPublish
+	if command == "" {
+		return nil
+	}
+	if *dryRun {
+		logf("Dry run: not running on_publish command.")
+		return nil
+	}
+	args, err := shlex.Split(command)
+	if err != nil || len(args) == 0 {
+		return fmt.Errorf("cannot parse on_publish command: %q", command)
+	}
+
+	diff, err := ioutil.TempFile("", "discedit-*.diff")
+	if err == nil {
+		_, err = diff.WriteString(unifiedDiff("old", "new", oldText, newText))
+		if closeErr := diff.Close(); err == nil {
+			err = closeErr
+		}
+		defer os.Remove(diff.Name())
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write diff for on_publish command: %v", err)
+	}
+
+	topicURL := topic.PostURL(forum)
+	topicID := strconv.Itoa(topic.ID)
+
+	logf("Running on_publish command...")
+
+	cmd := exec.Command(args[0], append(args[1:], topicURL, topicID, diff.Name())...)
+	cmd.Env = append(os.Environ(),
+		"DISCEDIT_TOPIC_URL="+topicURL,
+		"DISCEDIT_TOPIC_ID="+topicID,
+		"DISCEDIT_DIFF="+diff.Name(),
+	)
+	// The standard output is reserved for the URL printed once saved.
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("on_publish command failed: %v", err)
+	}
+	return nil
+}
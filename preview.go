@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/niemeyer/discedit/shlex"
+)
+
+// previewPath returns where the rendered preview of changes is written.
+func previewPath() string {
+	return configPath + ".preview.html"
+}
+
+const previewTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<base href="%s/">
+<style>
+body { margin: 0; font-family: sans-serif; }
+h1 { font-size: 1.2em; padding: 0.5em 1em; margin: 0; background: #eee; }
+.columns { display: flex; }
+.column { flex: 1; min-width: 0; padding: 0 1em; overflow-wrap: break-word; }
+.column + .column { border-left: 1px solid #ccc; }
+.column > h2 { color: #888; font-size: 1em; }
+img { max-width: 100%%; height: auto; }
+</style>
+</head>
+<body>
+<h1>%s</h1>
+<div class="columns">
+<div class="column"><h2>Before</h2>%s</div>
+<div class="column"><h2>After</h2>%s</div>
+</div>
+</body>
+</html>
+`
+
+// writePreview writes a page showing the rendered content of a post
+// before and after a change side by side, and opens it with $BROWSER
+// when that is set.
+func writePreview(forum *Forum, topic *Topic, oldCooked, newCooked string) error {
+	title := html.EscapeString(topic.Title)
+	page := fmt.Sprintf(previewTemplate, title, forum.baseURL, title, oldCooked, newCooked)
+	filename := previewPath()
+	err := ioutil.WriteFile(filename, []byte(page), 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write preview: %v", err)
+	}
+	abs, err := filepath.Abs(filename)
+	if err == nil {
+		filename = abs
+	}
+	logf("Rendered changes: file://%s", filename)
+
+	browser := strings.TrimSpace(os.Getenv("BROWSER"))
+	if browser == "" {
+		return nil
+	}
+	args, err := shlex.Split(browser)
+	if err != nil {
+		return fmt.Errorf("cannot parse browser command: %v", err)
+	}
+	cmd := exec.Command(args[0], append(args[1:], "file://"+filename)...)
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("cannot open browser: %v", err)
+	}
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+)
+
+// progress reports the advancement of batch operations that
+// process many items, and summarizes their outcome at the end.
+type progress struct {
+	total   int
+	current int
+	name    string
+
+	succeeded []string
+	failed    []string
+	skipped   []string
+}
+
+func newProgress(total int) *progress {
+	return &progress{total: total}
+}
+
+// Start reports that processing of the named item has started.
+func (p *progress) Start(name string) {
+	p.current++
+	p.name = name
+	logf("[%d/%d] %s", p.current, p.total, name)
+}
+
+// Succeeded records that the current item was processed successfully.
+func (p *progress) Succeeded() {
+	p.succeeded = append(p.succeeded, p.name)
+}
+
+// Failed records that processing of the current item failed with err.
+func (p *progress) Failed(err error) {
+	logf("[%d/%d] %s failed: %v", p.current, p.total, p.name, err)
+	p.failed = append(p.failed, fmt.Sprintf("%s: %v", p.name, err))
+}
+
+// Skipped records that the current item required no processing.
+func (p *progress) Skipped(reason string) {
+	logf("[%d/%d] %s skipped: %s", p.current, p.total, p.name, reason)
+	p.skipped = append(p.skipped, p.name)
+}
+
+// Summary logs the final outcome of the batch operation, and returns
+// an error if processing of any items failed.
+func (p *progress) Summary() error {
+	logf("Summary: %d succeeded, %d failed, %d skipped.", len(p.succeeded), len(p.failed), len(p.skipped))
+	if len(p.failed) == 0 {
+		return nil
+	}
+	for _, failure := range p.failed {
+		logf("Failed %s", failure)
+	}
+	return fmt.Errorf("%d of %d items failed", len(p.failed), p.total)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// pushMirror publishes all files changed locally in the mirror in dir,
+// such as one obtained with -dump-category, back to their topics. Each
+// is saved over the content it was mirrored from, so changes made in
+// the forum meanwhile are not silently overwritten.
+func pushMirror(config *Config, dir string) error {
+	mirror, err := readMirror(dir)
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, mirror.Forum)
+	if err != nil {
+		return err
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	var changed []*MirrorTopic
+	for _, mtopic := range mirror.Topics {
+		local, missing, err := mirror.LocalChange(mtopic)
+		if err != nil {
+			return err
+		}
+		if local && !missing {
+			changed = append(changed, mtopic)
+		}
+	}
+	if len(changed) == 0 {
+		logf("No files changed locally in %s.", dir)
+		return nil
+	}
+
+	stats.Phase("push")
+	progress := newProgress(len(changed))
+	for _, mtopic := range changed {
+		progress.Start(fmt.Sprintf("%s (%s)", mtopic.Title, mtopic.File))
+		saved, err := pushMirrored(forum, mirror, mtopic)
+		if err != nil {
+			progress.Failed(err)
+			continue
+		}
+		if !saved {
+			progress.Skipped("same content as in the forum")
+			continue
+		}
+		progress.Succeeded()
+	}
+	return progress.Summary()
+}
+
+// pushMirrored saves the content of the mirrored file into its topic,
+// and reports whether there was anything to save. The mirror index is
+// updated so the file is not reported as changed anymore.
+func pushMirrored(forum *Forum, mirror *Mirror, mtopic *MirrorTopic) (saved bool, err error) {
+	path := filepath.Join(mirror.dir, filepath.FromSlash(mtopic.File))
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("cannot read mirrored file: %v", err)
+	}
+	text, err := expandValues(string(data))
+	if err != nil {
+		return false, err
+	}
+	post, err := forum.LoadPost(mtopic.PostID)
+	if err != nil {
+		return false, err
+	}
+	err = checkMirrored(forum, post, mtopic, path)
+	if err != nil {
+		return false, err
+	}
+
+	if !sameText(text, post.Raw) {
+		oldText := post.Raw
+		post, err = forum.SavePost(post, text, oldText)
+		if err != nil || *dryRun {
+			return err == nil, err
+		}
+		saved = true
+		topic := &Topic{ID: post.TopicID, Slug: post.TopicSlug, Title: mtopic.Title, Post: post}
+		if err := runOnPublish(forum, topic, oldText, post.Raw); err != nil {
+			logf("WARNING: %v", err)
+		}
+	}
+	mtopic.Version = post.Version
+	mtopic.Hash = contentHash(data)
+	mtopic.ETag = ""
+	err = mirror.write()
+	if err != nil {
+		return saved, fmt.Errorf("cannot update mirror index: %v", err)
+	}
+	return saved, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// The queue holds topics to be edited later, collected with queue add
+// over the day and then processed in a single editing sprint with
+// queue run. Topics are only dropped from the queue once changes to
+// them were saved.
+
+type queueEntry struct {
+	URL   string    `json:"url"`
+	Added time.Time `json:"added"`
+}
+
+func queuePath() string {
+	return configPath + ".queue"
+}
+
+func readQueue() ([]*queueEntry, error) {
+	var entries []*queueEntry
+	data, err := ioutil.ReadFile(queuePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read queue: %v", err)
+	}
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode queue %s: %v", queuePath(), err)
+	}
+	return entries, nil
+}
+
+func writeQueue(entries []*queueEntry) error {
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return fmt.Errorf("internal error: cannot marshal queue: %v", err)
+	}
+	err = ioutil.WriteFile(queuePath(), data, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write queue: %v", err)
+	}
+	return nil
+}
+
+// updateQueue calls update with the queued entries and writes back the
+// ones it returns, holding the queue lock meanwhile.
+func updateQueue(update func(entries []*queueEntry) []*queueEntry) error {
+	unlock, err := lockPath(queuePath())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := readQueue()
+	if err != nil {
+		return err
+	}
+	return writeQueue(update(entries))
+}
+
+// runQueue adds topics to the queue, lists them, or edits them in turn.
+func runQueue(config *Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("queue command expects add, list, or run")
+	}
+	action := args[0]
+	args = subcommandArgs(args[1:])
+	switch action {
+	case "add":
+		if len(args) == 0 {
+			return fmt.Errorf("queue add expects one or more forum topic URLs")
+		}
+		return queueAdd(config, args)
+	case "list":
+		if len(args) != 0 {
+			return fmt.Errorf("queue list expects no arguments")
+		}
+		return queueList()
+	case "run":
+		if len(args) != 0 {
+			return fmt.Errorf("queue run expects no arguments")
+		}
+		return queueRun(config)
+	}
+	return fmt.Errorf("queue command expects add, list, or run")
+}
+
+func queueAdd(config *Config, args []string) error {
+	var urls []string
+	for _, arg := range args {
+		url := config.expandAlias(arg)
+		if !categoryURLPattern.MatchString(url) {
+			_, _, err := parseTopicURL(url)
+			if err != nil {
+				return err
+			}
+		}
+		urls = append(urls, url)
+	}
+	return updateQueue(func(entries []*queueEntry) []*queueEntry {
+		for _, url := range urls {
+			queued := false
+			for _, entry := range entries {
+				queued = queued || entry.URL == url
+			}
+			if queued {
+				logf("Already queued: %s", url)
+				continue
+			}
+			entries = append(entries, &queueEntry{URL: url, Added: time.Now()})
+			logf("Queued %s (%d in queue).", url, len(entries))
+		}
+		return entries
+	})
+}
+
+func queueList() error {
+	unlock, err := lockPath(queuePath())
+	if err != nil {
+		return err
+	}
+	entries, err := readQueue()
+	unlock()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		logf("Queue is empty.")
+		return nil
+	}
+	for i, entry := range entries {
+		fmt.Printf("%3d  %s  (added %s)\n", i+1, entry.URL, formatAge(time.Since(entry.Added)))
+	}
+	return nil
+}
+
+// queueRun edits the queued topics in order. Topics edited successfully
+// leave the queue right away, so that an interrupted run may continue
+// later where it stopped, while failed ones stay queued for another try.
+func queueRun(config *Config) error {
+	unlock, err := lockPath(queuePath())
+	if err != nil {
+		return err
+	}
+	entries, err := readQueue()
+	unlock()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		logf("Queue is empty.")
+		return nil
+	}
+
+	progress := newProgress(len(entries))
+	for i, entry := range entries {
+		if i > 0 && isTerminal(os.Stdin) && !confirm("Continue with the next topic?") {
+			logf("Stopping with %d topics left in the queue.", len(entries)-i)
+			break
+		}
+		progress.Start(entry.URL)
+		forum, topicID, postNumber, err := openPost(config, entry.URL)
+		saved := false
+		if err == nil {
+			saved, err = editTopicSaved(forum, topicID, postNumber)
+		}
+		if err != nil {
+			progress.Failed(err)
+			continue
+		}
+		if !saved || *dryRun {
+			progress.Skipped("nothing saved, kept in the queue")
+			continue
+		}
+		err = updateQueue(func(entries []*queueEntry) []*queueEntry {
+			var kept []*queueEntry
+			for _, e := range entries {
+				if e.URL != entry.URL {
+					kept = append(kept, e)
+				}
+			}
+			return kept
+		})
+		if err != nil {
+			progress.Failed(err)
+			continue
+		}
+		progress.Succeeded()
+	}
+	return progress.Summary()
+}
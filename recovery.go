@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/niemeyer/discedit/shlex"
+)
+
+// recoverSave asks the user how to proceed after saving the content in
+// filename failed with saveErr, and does it. It reports whether saving
+// should be retried, and the error to end the session with otherwise,
+// which is never nil as the changes were not published.
+func recoverSave(forum *Forum, topic *Topic, filename string, saveErr error) (retry bool, err error) {
+	question := "[r]etry, [e]dit, save to [f]ile"
+	if !forum.noDrafts {
+		question += ", save as [d]raft"
+	}
+	if isConflict(saveErr) {
+		question += ", resolve [h]unks, [m]erge tool"
+	}
+	question += ", or d[i]scard? "
+	for {
+		answer, err := readLine(question)
+		if err != nil {
+			return false, saveErr
+		}
+		switch strings.ToLower(answer) {
+		case "r", "retry":
+			return true, nil
+		case "e", "edit":
+			return true, reopenAfterFailure(forum, topic, filename, saveErr)
+		case "f", "file":
+			target, err := readLine("File to save content to: ")
+			if err != nil || target == "" {
+				continue
+			}
+			err = copyFile(filename, target)
+			if err != nil {
+				logf("Cannot save content: %v", err)
+				continue
+			}
+			logf("Saved content to %s.", target)
+			return false, fmt.Errorf("changes not published, kept in %s", target)
+		case "d", "draft":
+			if forum.noDrafts {
+				continue
+			}
+			err := forum.SaveDraft(topic, filename)
+			if err != nil {
+				logf("Cannot save draft: %v", err)
+				continue
+			}
+			return false, fmt.Errorf("changes not published, kept in the forum draft")
+		case "h", "hunks":
+			if !isConflict(saveErr) {
+				continue
+			}
+			err := resolveFileHunks(forum, topic, filename)
+			if err != nil {
+				logf("Cannot resolve conflicts: %v", err)
+				continue
+			}
+			return true, checkContent(forum, topic, filename)
+		case "m", "merge":
+			if !isConflict(saveErr) {
+				continue
+			}
+			err := runMergeTool(forum, topic, filename)
+			if err != nil {
+				return false, err
+			}
+			return true, checkContent(forum, topic, filename)
+		case "i", "discard":
+			return false, fmt.Errorf("changes discarded after failing to save: %v", saveErr)
+		}
+	}
+}
+
+func copyFile(from, to string) error {
+	data, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(to, data, 0644)
+}
+
+// runMergeTool runs the merge tool set in $DISCEDIT_MERGETOOL, or vimdiff,
+// to merge the changes made to the post in the forum into filename. The
+// tool is run with filename, the original content, and the content in the
+// forum as arguments, and must leave the merged result in filename.
+func runMergeTool(forum *Forum, topic *Topic, filename string) error {
+	current, err := forum.LoadPost(topic.Post.ID)
+	if err != nil {
+		return err
+	}
+	base, forumFile := filename+".base", filename+".forum"
+	err = ioutil.WriteFile(base, []byte(topic.OriginalText()+"\n"), 0600)
+	if err == nil {
+		err = ioutil.WriteFile(forumFile, []byte(current.Raw+"\n"), 0600)
+	}
+	defer os.Remove(base)
+	defer os.Remove(forumFile)
+	if err != nil {
+		return fmt.Errorf("cannot write files to merge: %v", err)
+	}
+
+	tool := strings.TrimSpace(os.Getenv("DISCEDIT_MERGETOOL"))
+	if tool == "" {
+		tool = "vimdiff"
+	}
+	args, err := shlex.Split(tool)
+	if err != nil {
+		return fmt.Errorf("cannot parse merge tool command: %v", err)
+	}
+	args = append(args, filename, base, forumFile)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("cannot run merge tool: %v", err)
+	}
+
+	topic.Post = current
+	topic.Draft = nil
+	return nil
+}
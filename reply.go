@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replyTopic writes a new reply to the topic or post with the given URL
+// in the editor, and posts it to the topic once the editor is closed,
+// printing the URL of the new post.
+//
+// While the reply is written it is saved as the topic's reply draft,
+// which is the same one the web composer uses, so it may be continued
+// in either place.
+func replyTopic(config *Config, url string) error {
+	forum, topicID, postNumber, err := openPost(config, url)
+	if err != nil {
+		return err
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+	topic, err := forum.LoadTopicPost(topicID, postNumber)
+	if err != nil {
+		return err
+	}
+	showNotes(forum, topic)
+	checkSlowMode(topic)
+
+	draft, err := forum.loadReplyDraft(topic)
+	if err != nil {
+		return err
+	}
+	initial := ""
+	if draft.Data != nil {
+		logf("Continuing reply from existing draft.")
+		initial = draft.Data.Reply
+	}
+
+	filename, err := createTempFile(initial)
+	if err != nil {
+		return err
+	}
+	err = forum.editReply(topic, draft, filename)
+	if err != nil {
+		renameToLast(filename)
+		return err
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		renameToLast(filename)
+		return fmt.Errorf("cannot read edited content at %s: %v", filename, err)
+	}
+	raw := storedText(string(content))
+	if strings.TrimSpace(raw) == "" {
+		os.Remove(filename)
+		logf("No content written, aborting.")
+		return nil
+	}
+	renameToLast(filename)
+
+	if *dryRun {
+		logf("Dry run: not replying to %s. Content would be:", topic)
+		showDiff("", raw)
+		return nil
+	}
+
+	err = waitReply(topic)
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{
+		"topic_id":  topic.ID,
+		"raw":       raw,
+		"draft_key": draft.Key,
+	}
+	if postNumber > 1 {
+		params["reply_to_post_number"] = postNumber
+	}
+	logf("Replying to %s...", topic)
+	post, err := forum.CreatePost(params)
+	if err != nil {
+		return err
+	}
+	// Printed even in quiet mode, for scripts to pick up.
+	fmt.Printf("%s/t/%s/%d/%d\n", forum.baseURL, topic.Slug, topic.ID, post.PostNumber)
+	return nil
+}
+
+// loadReplyDraft returns the reply draft for the topic. Its Data is nil
+// if no reply is being drafted, or if drafts cannot be used.
+func (f *Forum) loadReplyDraft(topic *Topic) (*Draft, error) {
+	draft := &Draft{
+		Key:     "topic_" + strconv.Itoa(topic.ID),
+		TopicID: topic.ID,
+	}
+	if f.noDrafts {
+		return draft, nil
+	}
+
+	var result struct {
+		Data     *DraftData `json:"draft"`
+		Sequence int        `json:"draft_sequence"`
+	}
+	err := f.do("GET", "/draft.json?draft_key="+draft.Key, nil, &result)
+	if isUnauthorized(err) {
+		f.denyDrafts(err)
+		return draft, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	draft.Sequence = result.Sequence
+	if result.Data != nil && result.Data.Action == "reply" {
+		draft.Data = result.Data
+	} else if result.Data != nil && !*ignoreDraft {
+		return nil, fmt.Errorf("topic has a draft editing it, which a reply draft would replace (see -ignore-draft)")
+	}
+	return draft, nil
+}
+
+// saveReplyDraft saves the content of filename as the reply draft.
+func (f *Forum) saveReplyDraft(topic *Topic, draft *Draft, filename string) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read edited content at %s: %v", filename, err)
+	}
+	if *dryRun {
+		debugf("Dry run: not saving reply draft for %s.", topic)
+		return nil
+	}
+	if f.noDrafts {
+		return errNoDrafts
+	}
+	data := &DraftData{
+		Action:       "reply",
+		Reply:        string(content),
+		ComposerTime: 4321,
+		TypingTime:   1234,
+	}
+	if topic.Post.PostNumber > 1 {
+		data.PostID = topic.Post.ID
+	}
+	draft.Data = data
+	return f.storeDraft(draft)
+}
+
+// editReply runs the editor on filename, saving its content as the
+// reply draft whenever it changes.
+func (f *Forum) editReply(topic *Topic, draft *Draft, filename string) error {
+	stamp, err := stampFile(filename)
+	if err != nil {
+		return fmt.Errorf("cannot stat temporary file: %v", err)
+	}
+	stop := make(chan bool)
+	done := make(chan bool)
+
+	go func() {
+		defer close(done)
+		last := false
+		for !last {
+			select {
+			case <-time.After(500 * time.Millisecond):
+			case <-stop:
+				last = true
+			}
+			curstamp, err := stampFile(filename)
+			if os.IsNotExist(err) {
+				debugf("Waiting for %s to be saved again.", filename)
+				continue
+			}
+			if err != nil {
+				debugf("Error stating file for draft: %v", err)
+				continue
+			}
+			if curstamp.Same(stamp) {
+				continue
+			}
+			err = f.saveReplyDraft(topic, draft, filename)
+			if err != nil {
+				debugf("Error saving reply draft: %v", err)
+				if err != errNoDrafts {
+					continue
+				}
+			}
+			stamp = curstamp
+		}
+	}()
+
+	logf("Opening your preferred editor...")
+
+	quietMode = true
+	err = runEditor(filename)
+	close(stop)
+	<-done
+	quietMode = false
+
+	return err
+}
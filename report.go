@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// reportStarted is set once the report index was started in this run.
+var reportStarted bool
+
+// writeReport writes the changes that saving raw into post would make
+// as a diff file in the -report directory, and lists it in the index
+// file there, so that the whole change set of a batch operation can
+// be reviewed before it is applied.
+func writeReport(forum *Forum, post *Post, rawOld, raw string) error {
+	dir := *reportDir
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create report directory: %v", err)
+	}
+	url := fmt.Sprintf("%s/t/%d/%d", forum.baseURL, post.TopicID, post.PostNumber)
+	name := fmt.Sprintf("topic-%d-post-%d.diff", post.TopicID, post.PostNumber)
+	diff := unifiedDiff(url, url, rawOld+"\n", raw+"\n")
+	err = ioutil.WriteFile(filepath.Join(dir, name), []byte(diff), 0644)
+	if err != nil {
+		return fmt.Errorf("cannot write report: %v", err)
+	}
+
+	added, removed := diffStat(rawOld, raw)
+	// The index lists the changes of this run only, as the diff files
+	// of earlier runs into the same directory are overwritten too.
+	flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
+	if !reportStarted {
+		flags |= os.O_TRUNC
+	}
+	index, err := os.OpenFile(filepath.Join(dir, "index.md"), flags, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot write report index: %v", err)
+	}
+	_, err = fmt.Fprintf(index, "* [%s](%s) +%d -%d\n", url, name, added, removed)
+	if closeErr := index.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write report index: %v", err)
+	}
+	reportStarted = true
+	logf("Reported changes to post %d in %s.", post.PostNumber, filepath.Join(dir, name))
+	return nil
+}
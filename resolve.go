@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// hunkContext is the number of unchanged lines shown before each
+// conflicting hunk by resolveHunks.
+const hunkContext = 2
+
+// resolveHunks merges the changes made in ours and theirs to base, asking
+// in the terminal how to resolve each region changed differently on both
+// sides, similarly to git add -p. This works anywhere a terminal does,
+// such as over SSH, with no merge tool around. It reports whether all
+// conflicts were resolved, rather than the user giving up.
+func resolveHunks(base, ours, theirs string) (merged string, ok bool) {
+	chunks := mergeChunks(storedText(base), ours, theirs)
+	total := 0
+	for _, chunk := range chunks {
+		if chunk.Conflict {
+			total++
+		}
+	}
+
+	var lines []string
+	n := 0
+	for i, chunk := range chunks {
+		if !chunk.Conflict {
+			result, _ := chunk.Result()
+			lines = append(lines, result...)
+			continue
+		}
+		n++
+		var context []string
+		if i > 0 && chunks[i-1].Stable {
+			context = chunks[i-1].Ours
+			if len(context) > hunkContext {
+				context = context[len(context)-hunkContext:]
+			}
+		}
+		printHunk(n, total, context, chunk)
+		result, ok := askHunk(chunk)
+		if !ok {
+			return "", false
+		}
+		lines = append(lines, result...)
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+func printHunk(n, total int, context []string, chunk *mergeChunk) {
+	fmt.Printf("Conflict %d of %d:\n", n, total)
+	for _, line := range context {
+		fmt.Printf("        %s\n", line)
+	}
+	for _, line := range chunk.Ours {
+		fmt.Printf("  yours %s\n", line)
+	}
+	for _, line := range chunk.Theirs {
+		fmt.Printf("  forum %s\n", line)
+	}
+}
+
+// askHunk asks how to resolve the conflicting chunk, and returns the
+// lines it is resolved into.
+func askHunk(chunk *mergeChunk) (lines []string, ok bool) {
+	question := "Keep [y]ours, keep the [f]orum's, keep [b]oth, [e]dit, or [q]uit? "
+	for {
+		answer, err := readLine(question)
+		if err != nil {
+			return nil, false
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yours":
+			return chunk.Ours, true
+		case "f", "forum":
+			return chunk.Theirs, true
+		case "b", "both":
+			return append(append([]string(nil), chunk.Ours...), chunk.Theirs...), true
+		case "e", "edit":
+			lines, err := editHunk(chunk)
+			if err != nil {
+				logf("Cannot edit conflict: %v", err)
+				continue
+			}
+			return lines, true
+		case "q", "quit":
+			return nil, false
+		}
+	}
+}
+
+// editHunk opens the editor on the conflicting chunk, with both sides
+// between conflict markers, and returns the lines left by the user.
+func editHunk(chunk *mergeChunk) ([]string, error) {
+	var text []string
+	text = append(text, conflictMarker)
+	text = append(text, chunk.Ours...)
+	text = append(text, "=======")
+	text = append(text, chunk.Theirs...)
+	text = append(text, ">>>>>>> forum")
+
+	// Not created with createTempFile, which would clash with the
+	// file holding the whole content being edited.
+	f, err := ioutil.TempFile("", "discedit-conflict-*.md")
+	if err != nil {
+		return nil, err
+	}
+	filename := f.Name()
+	defer os.Remove(filename)
+	_, err = f.WriteString(strings.Join(text, "\n") + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = runEditor(filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	edited := strings.TrimRight(string(data), "\n")
+	if strings.Contains(edited, conflictMarker) {
+		return nil, fmt.Errorf("conflict markers left in place")
+	}
+	return splitLines(edited), nil
+}
+
+// resolveFileHunks resolves the conflicts between the content in filename
+// and the changes made to the post in the forum meanwhile, hunk by hunk,
+// leaving the result in filename to be saved over the current post.
+func resolveFileHunks(forum *Forum, topic *Topic, filename string) error {
+	current, err := forum.LoadPost(topic.Post.ID)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read edited content at %s: %v", filename, err)
+	}
+	merged, ok := resolveHunks(topic.OriginalText(), storedText(string(data)), storedText(current.Raw))
+	if !ok {
+		return fmt.Errorf("conflicts left unresolved")
+	}
+	err = ioutil.WriteFile(filename, []byte(merged+"\n"), 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write resolved content: %v", err)
+	}
+	topic.Post = current
+	topic.Draft = nil
+	return nil
+}
+
+// resolveDraft resolves the conflicts between the changes in the draft
+// of the topic and those made to the post after the draft was started,
+// hunk by hunk, updating the draft to apply to the current post.
+func resolveDraft(topic *Topic) error {
+	merged, ok := resolveHunks(topic.Draft.OriginalText(), storedText(topic.Draft.EditText()), storedText(topic.Post.Raw))
+	if !ok {
+		return fmt.Errorf("conflicts in draft left unresolved")
+	}
+	topic.Draft.Data.Reply = merged
+	topic.Draft.Data.OriginalText = topic.Post.OriginalText()
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backupDir returns the directory holding backups of edited content,
+// kept per topic so they may be published again with the restore command.
+func backupDir() string {
+	return configPath + ".backups"
+}
+
+// maxBackups is the number of backups kept for each post.
+const maxBackups = 10
+
+// backupPrefix returns the prefix of the names of backup files of the
+// post. As with sessions, the forum is identified by a hash of its URL.
+func backupPrefix(forum *Forum, post *Post) string {
+	sum := sha256.Sum256([]byte(forum.baseURL))
+	return fmt.Sprintf("%s-%d-%d-", hex.EncodeToString(sum[:4]), post.TopicID, post.PostNumber)
+}
+
+// keepBackup stores text as the newest backup of the topic post,
+// dropping the oldest backups beyond maxBackups.
+func keepBackup(forum *Forum, topic *Topic, text string) {
+	prefix := backupPrefix(forum, topic.Post)
+	err := os.MkdirAll(backupDir(), 0700)
+	if err == nil {
+		path := filepath.Join(backupDir(), prefix+time.Now().Format("20060102-150405.000000")+".md")
+		err = ioutil.WriteFile(path, []byte(text), 0600)
+	}
+	if err != nil {
+		logf("WARNING: Cannot save backup: %v", err)
+		return
+	}
+	names, err := filepath.Glob(filepath.Join(backupDir(), prefix+"*.md"))
+	if err != nil {
+		return
+	}
+	sort.Strings(names)
+	for len(names) > maxBackups {
+		os.Remove(names[0])
+		names = names[1:]
+	}
+}
+
+// backupFile is a local copy of the content of a post, either kept
+// as a backup after editing or written as a snapshot while editing.
+type backupFile struct {
+	Path string
+	Kind string
+	Time time.Time
+}
+
+// listBackups returns the backups and snapshots of the topic post,
+// newest first.
+func listBackups(forum *Forum, topic *Topic) ([]*backupFile, error) {
+	var backups []*backupFile
+	add := func(pattern, kind string) error {
+		names, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			info, err := os.Stat(name)
+			if err != nil {
+				return err
+			}
+			backups = append(backups, &backupFile{Path: name, Kind: kind, Time: info.ModTime()})
+		}
+		return nil
+	}
+	err := add(filepath.Join(backupDir(), backupPrefix(forum, topic.Post)+"*.md"), "backup")
+	if err == nil {
+		// Snapshots are not qualified by forum.
+		err = add(filepath.Join(snapshotDir(), fmt.Sprintf("%d-%d-*.md", topic.ID, topic.Post.PostNumber)), "snapshot")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot list backups: %v", err)
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// runRestore lists the local backups of a topic and publishes the
+// one picked, after showing how it differs from the forum content.
+func runRestore(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("restore command expects a single topic URL")
+	}
+	forum, topicID, postNumber, err := openPost(config, args[0])
+	if err != nil {
+		return err
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+	topic, err := forum.LoadTopicPost(topicID, postNumber)
+	if err != nil {
+		return err
+	}
+	backups, err := listBackups(forum, topic)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("no local backups of %s", topic)
+	}
+
+	for i, backup := range backups {
+		fmt.Printf("%3d  %-8s  %s  %s\n", i+1, backup.Kind, backup.Time.Format("2006-01-02 15:04:05"), formatAge(time.Since(backup.Time)))
+	}
+	answer, err := readLine("Backup to restore (empty to quit): ")
+	if err != nil || answer == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(backups) {
+		return fmt.Errorf("no backup number %s", answer)
+	}
+	backup := backups[n-1]
+
+	data, err := ioutil.ReadFile(backup.Path)
+	if err != nil {
+		return fmt.Errorf("cannot read backup: %v", err)
+	}
+	if sameText(string(data), topic.Post.Raw) {
+		logf("Backup matches the content in the forum. No changes to save.")
+		return nil
+	}
+	if !*dryRun {
+		showDiff(topic.Post.Raw, strings.TrimSpace(string(data)))
+		if !confirm("Publish this backup?") {
+			return nil
+		}
+		// The content being replaced can be restored in turn.
+		keepBackup(forum, topic, topic.Post.Raw+"\n")
+	}
+	oldText := topic.Post.Raw
+	post, err := forum.SavePost(topic.Post, string(data), topic.OriginalText())
+	if err != nil || *dryRun {
+		return err
+	}
+	logf("Restored %s.", topic)
+	topic.Post = post
+	if err := runOnPublish(forum, topic, oldText, post.Raw); err != nil {
+		logf("WARNING: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// runRetag adds and removes tags on every topic matching a search,
+// as done when migrating the tag taxonomy of a forum.
+func runRetag(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("retag command expects a single forum URL")
+	}
+	if *search == "" {
+		return fmt.Errorf("retag command requires the -search option")
+	}
+	add, remove := splitTags(*addTags), splitTags(*removeTags)
+	if len(add) == 0 && len(remove) == 0 {
+		return fmt.Errorf("retag command requires the -add or -remove options")
+	}
+	baseURL, err := parseForumURL(config.expandAlias(args[0]))
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, baseURL)
+	if err != nil {
+		return err
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	stats.Phase("search")
+	topics, err := forum.SearchTopics(*search)
+	if err != nil {
+		return err
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("no topics match %q", *search)
+	}
+
+	stats.Phase("retag")
+	progress := newProgress(len(topics))
+	for _, topic := range topics {
+		progress.Start(topic.Title)
+		tags := retagged(topic.Tags, add, remove)
+		if strings.Join(tags, ",") == strings.Join(topic.Tags, ",") {
+			progress.Skipped("no changes")
+			continue
+		}
+		err := forum.SetTags(topic, tags)
+		if err != nil {
+			progress.Failed(err)
+			continue
+		}
+		progress.Succeeded()
+	}
+	return progress.Summary()
+}
+
+// splitTags returns the tags in a comma-separated list.
+func splitTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// retagged returns tags without those in remove and with those in add,
+// preserving the order of tags kept. Tags are compared ignoring case,
+// as the forum does.
+func retagged(tags Tags, add, remove []string) []string {
+	has := func(list []string, tag string) bool {
+		for _, t := range list {
+			if strings.EqualFold(t, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	result := []string{}
+	for _, tag := range tags {
+		if !has(remove, tag) {
+			result = append(result, tag)
+		}
+	}
+	for _, tag := range add {
+		if !has(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// SearchTopics returns the topics matching the query, which may use
+// the advanced search syntax of the forum (e.g. "tags:old-tag").
+func (f *Forum) SearchTopics(query string) ([]*Topic, error) {
+
+	logf("Searching for %q...", query)
+
+	var topics []*Topic
+	seen := make(map[int]bool)
+	for page := 1; ; page++ {
+		var result struct {
+			Topics  []*Topic `json:"topics"`
+			Grouped struct {
+				MoreResults bool `json:"more_full_page_results"`
+			} `json:"grouped_search_result"`
+		}
+		err := f.do("GET", "/search.json?q="+url.QueryEscape(query)+"&page="+strconv.Itoa(page), nil, &result)
+		if err != nil {
+			return nil, fmt.Errorf("cannot search forum: %v", err)
+		}
+		for _, topic := range result.Topics {
+			if !seen[topic.ID] {
+				seen[topic.ID] = true
+				topics = append(topics, topic)
+			}
+		}
+		if len(result.Topics) == 0 || !result.Grouped.MoreResults {
+			break
+		}
+	}
+	return topics, nil
+}
+
+// SetTags replaces the tags of the topic.
+func (f *Forum) SetTags(topic *Topic, tags []string) error {
+	if *dryRun {
+		logf("Dry run: not changing tags of %s from [%s] to [%s].", topic, strings.Join(topic.Tags, ", "), strings.Join(tags, ", "))
+		return nil
+	}
+
+	logf("Changing tags of %s to [%s]...", topic, strings.Join(tags, ", "))
+
+	body := map[string]interface{}{
+		"tags": tags,
+	}
+	err := f.do("PUT", "/t/-/"+strconv.Itoa(topic.ID)+".json", body, nil)
+	if err != nil {
+		return fmt.Errorf("cannot change tags: %v", err)
+	}
+	topic.Tags = tags
+	return nil
+}
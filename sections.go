@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AuthorPosts returns the first post of the topic followed by all
+// the replies written by the same author.
+func (t *Topic) AuthorPosts() []*Post {
+	posts := []*Post{t.Post}
+	for _, post := range t.Posts {
+		if post.ID != t.Post.ID && post.Username == t.Post.Username {
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+var sectionPattern = regexp.MustCompile(`(?m)^<!-- discedit post ([0-9]+) -->[ \t]*$`)
+
+func sectionMarker(post *Post) string {
+	return fmt.Sprintf("<!-- discedit post %d -->", post.PostNumber)
+}
+
+// joinSections returns the content of all posts in a single text, with
+// every post after the first one preceded by a marker line that
+// identifies it.
+func joinSections(posts []*Post) string {
+	var buf strings.Builder
+	for i, post := range posts {
+		if i > 0 {
+			buf.WriteString("\n\n")
+			buf.WriteString(sectionMarker(post))
+			buf.WriteString("\n\n")
+		}
+		buf.WriteString(strings.TrimSpace(post.Raw))
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// splitSections breaks down text produced by joinSections and returns
+// the content of each post, keyed by post number. The first post must
+// be provided so that the content before any markers is assigned to it.
+// If there is no such content the first post has no section, unless a
+// marker for it follows. Markers inside fenced code blocks are ignored.
+func splitSections(text string, first *Post) (map[int]string, error) {
+	sections := make(map[int]string)
+	number := first.PostNumber
+	start := 0
+	for _, m := range sectionMarkers(text) {
+		if content := strings.TrimSpace(text[start:m[0]]); start > 0 || content != "" {
+			sections[number] = content
+		}
+		n, err := strconv.Atoi(text[m[2]:m[3]])
+		if err != nil {
+			return nil, fmt.Errorf("internal error: section pattern matched with non-int post number")
+		}
+		if _, ok := sections[n]; ok {
+			return nil, fmt.Errorf("post %d has more than one section", n)
+		}
+		number = n
+		start = m[1]
+	}
+	sections[number] = strings.TrimSpace(text[start:])
+	return sections, nil
+}
+
+// sectionMarkers returns the submatch indexes of all section markers
+// in text that are not inside fenced code blocks.
+func sectionMarkers(text string) [][]int {
+	var markers [][]int
+	var fence string
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if strings.HasPrefix(m[1], fence) && strings.TrimSpace(line) == m[1] {
+				fence = ""
+			}
+		} else if m := sectionPattern.FindStringSubmatchIndex(line); fence == "" && m != nil {
+			for i := range m {
+				m[i] += offset
+			}
+			markers = append(markers, m)
+		}
+		offset += len(line)
+	}
+	return markers
+}
+
+func runAuthorPosts(forum *Forum, topic *Topic) error {
+	err := forum.LoadAllPosts(topic)
+	if err != nil {
+		return err
+	}
+	posts := topic.AuthorPosts()
+	text := joinSections(posts)
+
+	filename, err := createTempFile(text)
+	if err != nil {
+		return err
+	}
+
+	logf("Opening your preferred editor...")
+
+	stats.Phase("edit")
+	err = runEditor(filename)
+	if err != nil {
+		return err
+	}
+
+	different, empty, err := fileChanged(filename, text)
+	if err == nil && empty {
+		os.Remove(filename)
+		return fmt.Errorf("no content provided, aborting")
+	}
+	if err == nil && !different {
+		logf("No changes to save.")
+		os.Remove(filename)
+		return nil
+	}
+	var saved = 0
+	if err == nil {
+		stats.Phase("save")
+		saved, err = saveSections(forum, topic, posts, filename)
+	}
+	if err != nil {
+		if saved > 0 {
+			logf("Saved %d of the changed posts before failing.", saved)
+		}
+		renameToLast(filename)
+		return err
+	}
+	os.Remove(filename)
+	return nil
+}
+
+func saveSections(forum *Forum, topic *Topic, posts []*Post, filename string) (saved int, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read edited content at %s: %v", filename, err)
+	}
+	sections, err := splitSections(string(data), posts[0])
+	if err != nil {
+		return 0, err
+	}
+	for _, post := range posts {
+		if _, ok := sections[post.PostNumber]; !ok {
+			return 0, fmt.Errorf("section for post %d is missing; posts cannot be deleted here", post.PostNumber)
+		}
+	}
+	for number := range sections {
+		found := false
+		for _, post := range posts {
+			found = found || post.PostNumber == number
+		}
+		if !found {
+			return 0, fmt.Errorf("post %d is not one of the posts being edited", number)
+		}
+	}
+
+	for i, post := range posts {
+		raw := sections[post.PostNumber]
+		if raw == strings.TrimSpace(post.Raw) {
+			continue
+		}
+		if raw == "" {
+			return saved, fmt.Errorf("no content provided for post %d, aborting", post.PostNumber)
+		}
+		logf("Saving post %d of %s ...", post.PostNumber, topic)
+		updated, err := forum.SavePost(post, raw, post.Raw)
+		if err != nil {
+			return saved, err
+		}
+		posts[i] = updated
+		saved++
+		journal.Record("save", fmt.Sprintf("post %d", post.PostNumber))
+	}
+	if !*dryRun {
+		logf("Saved %d posts of %s.", saved, topic)
+	}
+	return saved, nil
+}
+
+// WikiPosts returns all posts of the topic that are wikis.
+func (t *Topic) WikiPosts() []*Post {
+	var posts []*Post
+	for _, post := range t.Posts {
+		if post.Wiki {
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+func runAllWiki(forum *Forum, topic *Topic) error {
+	err := forum.LoadAllPosts(topic)
+	if err != nil {
+		return err
+	}
+	posts := topic.WikiPosts()
+	if len(posts) == 0 {
+		return fmt.Errorf("topic %s has no wiki posts", topic)
+	}
+	progress := newProgress(len(posts))
+	for _, post := range posts {
+		topic.Post = post
+		topic.Draft = nil
+		progress.Start("Editing wiki post " + topic.String())
+		saved, err := editPost(forum, topic)
+		switch {
+		case err != nil:
+			progress.Failed(err)
+		case saved:
+			progress.Succeeded()
+		default:
+			progress.Skipped("no changes")
+		}
+	}
+	return progress.Summary()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSections(t *testing.T) {
+	tests := []struct {
+		summary  string
+		text     string
+		sections map[int]string
+		err      string
+	}{{
+		summary:  "First post only",
+		text:     "First.\n",
+		sections: map[int]string{1: "First."},
+	}, {
+		summary:  "Several posts",
+		text:     "First.\n\n<!-- discedit post 3 -->\n\nThird.\n\n<!-- discedit post 7 -->  \n\nSeventh.\n",
+		sections: map[int]string{1: "First.", 3: "Third.", 7: "Seventh."},
+	}, {
+		summary:  "Marker inside a fenced code block",
+		text:     "First.\n\n```\n<!-- discedit post 3 -->\n```\n\n<!-- discedit post 3 -->\n\nThird.\n",
+		sections: map[int]string{1: "First.\n\n```\n<!-- discedit post 3 -->\n```", 3: "Third."},
+	}, {
+		summary:  "Marker inside a tilde fence holding backticks",
+		text:     "First.\n~~~~\n```\n<!-- discedit post 3 -->\n```\n~~~~\n",
+		sections: map[int]string{1: "First.\n~~~~\n```\n<!-- discedit post 3 -->\n```\n~~~~"},
+	}, {
+		summary:  "Marker not on a line of its own",
+		text:     "First. <!-- discedit post 3 -->\n",
+		sections: map[int]string{1: "First. <!-- discedit post 3 -->"},
+	}, {
+		summary: "Duplicate marker",
+		text:    "First.\n\n<!-- discedit post 3 -->\n\nThird.\n\n<!-- discedit post 3 -->\n\nAgain.\n",
+		err:     "post 3 has more than one section",
+	}, {
+		summary: "Marker for the first post after its content",
+		text:    "First.\n\n<!-- discedit post 1 -->\n\nAgain.\n",
+		err:     "post 1 has more than one section",
+	}, {
+		summary:  "Missing first section",
+		text:     "<!-- discedit post 3 -->\n\nThird.\n",
+		sections: map[int]string{3: "Third."},
+	}, {
+		summary:  "Explicit marker for the first post",
+		text:     "\n<!-- discedit post 1 -->\n\nFirst.\n\n<!-- discedit post 3 -->\n\nThird.\n",
+		sections: map[int]string{1: "First.", 3: "Third."},
+	}, {
+		summary:  "Empty section after a marker",
+		text:     "First.\n\n<!-- discedit post 3 -->\n",
+		sections: map[int]string{1: "First.", 3: ""},
+	}}
+
+	for _, test := range tests {
+		sections, err := splitSections(test.text, &Post{PostNumber: 1})
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s:\ngot error %v, want %q", test.summary, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s:\nunexpected error: %v", test.summary, err)
+			continue
+		}
+		if !reflect.DeepEqual(sections, test.sections) {
+			t.Errorf("%s:\ngot  %q\nwant %q", test.summary, sections, test.sections)
+		}
+	}
+}
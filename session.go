@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// topicSession marks a topic as being edited by this process, so that
+// other discedit sessions for the same topic on this machine notice it
+// and may attach to the file being edited instead of diverging from it.
+type topicSession struct {
+	path   string
+	unlock func()
+}
+
+// sessionPath returns the path holding details of the session editing
+// the topic post. The forum is identified by a hash of its URL.
+func sessionPath(forum *Forum, topic *Topic) string {
+	sum := sha256.Sum256([]byte(forum.baseURL))
+	if topic.Post.PostNumber > 1 {
+		return fmt.Sprintf("%s.session-%s-%d-%d", configPath, hex.EncodeToString(sum[:4]), topic.ID, topic.Post.PostNumber)
+	}
+	return fmt.Sprintf("%s.session-%s-%d", configPath, hex.EncodeToString(sum[:4]), topic.ID)
+}
+
+// startTopicSession starts a session for editing the topic. If another
+// session is editing it already, the user is offered to attach to that
+// session's file, in which case attached is true and the returned session
+// is nil, or to start a separate session anyway.
+func startTopicSession(forum *Forum, topic *Topic) (session *topicSession, attached bool, err error) {
+	path := sessionPath(forum, topic)
+	unlock, ok, err := tryLockPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		session = &topicSession{path: path, unlock: unlock}
+		session.write("")
+		return session, false, nil
+	}
+
+	pid, filename := readSession(path)
+	logf("WARNING: Topic %s is already being edited in another discedit session (process %d).", topic, pid)
+	if filename != "" && !*dryRun {
+		if _, err := os.Stat(filename); err == nil && confirm("Attach to that session and edit the same file?") {
+			err = runEditor(filename)
+			if err != nil {
+				return nil, false, err
+			}
+			logf("Changes are saved by the other session when its editor is closed.")
+			return nil, true, nil
+		}
+	}
+	if !confirm("Start a separate session anyway?") {
+		return nil, false, fmt.Errorf("topic %s is already being edited", topic)
+	}
+	return nil, false, nil
+}
+
+// SetFile records the file being edited in the session, so that other
+// sessions may attach to it.
+func (s *topicSession) SetFile(filename string) {
+	if s != nil {
+		s.write(filename)
+	}
+}
+
+// End finishes the session, allowing others to start.
+func (s *topicSession) End() {
+	if s != nil {
+		os.Remove(s.path)
+		s.unlock()
+	}
+}
+
+func (s *topicSession) write(filename string) {
+	data := fmt.Sprintf("%d\n%s\n", os.Getpid(), filename)
+	err := ioutil.WriteFile(s.path, []byte(data), 0600)
+	if err != nil {
+		debugf("Cannot write session details: %v", err)
+	}
+}
+
+// readSession returns the process ID and file being edited by the
+// session with details at path.
+func readSession(path string) (pid int, filename string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, ""
+	}
+	lines := strings.Split(string(data), "\n")
+	pid, _ = strconv.Atoi(lines[0])
+	if len(lines) > 1 {
+		filename = lines[1]
+	}
+	return pid, filename
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// siteSettingsCacheAge is how long the site settings of a forum are cached.
+const siteSettingsCacheAge = time.Hour
+
+// SiteSettings returns the site settings of the forum, keyed by name.
+// Site settings are only visible to administrators, so when they cannot
+// be obtained the returned map is empty and no error is reported, leaving
+// it up to the forum to enforce them.
+func (f *Forum) SiteSettings() map[string]string {
+	if f.siteSettings != nil {
+		return f.siteSettings
+	}
+	key := f.baseURL + " site settings"
+	if cacheGet(key, siteSettingsCacheAge, &f.siteSettings) && f.siteSettings != nil {
+		return f.siteSettings
+	}
+
+	logf("Checking site settings...")
+
+	var result struct {
+		SiteSettings []struct {
+			Setting string      `json:"setting"`
+			Value   interface{} `json:"value"`
+		} `json:"site_settings"`
+	}
+	f.siteSettings = make(map[string]string)
+	err := f.do("GET", "/admin/site_settings.json", nil, &result)
+	if err != nil {
+		debugf("Cannot obtain site settings: %v", err)
+		return f.siteSettings
+	}
+	for _, s := range result.SiteSettings {
+		if s.Value != nil {
+			f.siteSettings[s.Setting] = fmt.Sprint(s.Value)
+		}
+	}
+	err = cacheSet(key, f.siteSettings)
+	if err != nil {
+		debugf("Cannot cache site settings: %v", err)
+	}
+	return f.siteSettings
+}
+
+// PublicSiteSettings returns the site settings the forum shares with
+// all of its users, keyed by name. These are only some of those known
+// to SiteSettings, but they are visible without an admin key. When they
+// cannot be obtained the returned map is empty and no error is reported.
+func (f *Forum) PublicSiteSettings() map[string]string {
+	if f.publicSettings != nil {
+		return f.publicSettings
+	}
+	key := f.baseURL + " public site settings"
+	if cacheGet(key, siteSettingsCacheAge, &f.publicSettings) && f.publicSettings != nil {
+		return f.publicSettings
+	}
+
+	var result map[string]interface{}
+	f.publicSettings = make(map[string]string)
+	err := f.do("GET", "/site/settings.json", nil, &result)
+	if err != nil {
+		debugf("Cannot obtain public site settings: %v", err)
+		return f.publicSettings
+	}
+	for name, value := range result {
+		if value != nil {
+			f.publicSettings[name] = fmt.Sprint(value)
+		}
+	}
+	err = cacheSet(key, f.publicSettings)
+	if err != nil {
+		debugf("Cannot cache public site settings: %v", err)
+	}
+	return f.publicSettings
+}
+
+// siteSettingInt returns the named site setting as an integer, and
+// whether it is known.
+func (f *Forum) siteSettingInt(name string) (int, bool) {
+	value, ok := f.SiteSettings()[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		debugf("Site setting %s is not an integer: %q", name, value)
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Site holds the public information a forum provides about itself
+// via /site.json, as visible to the configured user.
+type Site struct {
+	Categories []*SiteCategory `json:"categories"`
+}
+
+// SiteCategory is a category as described in /site.json.
+type SiteCategory struct {
+	ID                  int    `json:"id"`
+	Name                string `json:"name"`
+	Slug                string `json:"slug"`
+	ParentCategoryID    int    `json:"parent_category_id"`
+	MinimumRequiredTags int    `json:"minimum_required_tags"`
+
+	// Permission is the access level of the user to the category:
+	// 1 for creating topics, 2 for replying, and 3 for reading only.
+	Permission int `json:"permission"`
+}
+
+// ReadOnly reports whether the user can only read the category.
+func (c *SiteCategory) ReadOnly() bool {
+	return c.Permission == 3
+}
+
+// Site returns the site information of the forum. It is requested at
+// most once per run.
+func (f *Forum) Site() (*Site, error) {
+	if f.site != nil {
+		return f.site, nil
+	}
+	var site Site
+	err := f.do("GET", "/site.json", nil, &site)
+	if err != nil {
+		return nil, err
+	}
+	f.site = &site
+	return f.site, nil
+}
+
+// Category returns the category with the given ID, or nil if the
+// category is not visible to the configured user.
+func (s *Site) Category(id int) *SiteCategory {
+	for _, c := range s.Categories {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// CategoryByPath returns the category at the given path, such as
+// "parent/child" or "slug/ID", or nil if the category is not visible
+// to the configured user.
+func (s *Site) CategoryByPath(categoryPath string) *SiteCategory {
+	parts := strings.Split(strings.Trim(categoryPath, "/"), "/")
+	if id, err := strconv.Atoi(parts[len(parts)-1]); err == nil && len(parts) > 1 {
+		return s.Category(id)
+	}
+	slug := parts[len(parts)-1]
+	var parent *SiteCategory
+	if len(parts) > 1 {
+		parent = s.CategoryByPath(strings.Join(parts[:len(parts)-1], "/"))
+		if parent == nil {
+			return nil
+		}
+	}
+	for _, c := range s.Categories {
+		if c.Slug == slug && (parent == nil || c.ParentCategoryID == parent.ID) {
+			return c
+		}
+	}
+	return nil
+}
+
+// checkCategoryAccess returns an error if the category at the given
+// path is not visible to the configured user, and logs a warning if
+// the user can only read it. If the site information cannot be
+// obtained the category is assumed to be accessible.
+func checkCategoryAccess(forum *Forum, categoryPath string) error {
+	site, err := forum.Site()
+	if err != nil {
+		debugf("Cannot obtain site information: %v", err)
+		return nil
+	}
+	c := site.CategoryByPath(categoryPath)
+	if c == nil {
+		return fmt.Errorf("category %s does not exist or is not visible to the configured user", categoryPath)
+	}
+	if c.ReadOnly() {
+		logf("WARNING: Category %s is read-only for the configured user.", categoryPath)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotDir returns the directory holding local snapshots of the
+// content being edited.
+func snapshotDir() string {
+	return configPath + ".snapshots"
+}
+
+// snapshotter writes timestamped copies of the file being edited to
+// the snapshot directory every so often, independently of the forum,
+// so that an outage or authentication failure can't lose much work.
+type snapshotter struct {
+	name  string
+	every time.Duration
+	last  time.Time
+	text  string
+}
+
+func newSnapshotter(topic *Topic, text string) *snapshotter {
+	return &snapshotter{
+		name:  fmt.Sprintf("%d-%d", topic.ID, topic.Post.PostNumber),
+		every: time.Duration(*snapshotInterval) * time.Minute,
+		last:  time.Now(),
+		text:  text,
+	}
+}
+
+// Check writes a snapshot of filename if the snapshot interval has
+// passed and the content changed since the last snapshot.
+func (s *snapshotter) Check(filename string) {
+	if s.every <= 0 || time.Since(s.last) < s.every {
+		return
+	}
+	s.last = time.Now()
+	data, err := ioutil.ReadFile(filename)
+	if err != nil || string(data) == s.text {
+		return
+	}
+	err = os.MkdirAll(snapshotDir(), 0700)
+	if err == nil {
+		path := filepath.Join(snapshotDir(), s.name+"-"+s.last.Format("20060102-150405")+".md")
+		err = ioutil.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		debugf("Cannot write snapshot: %v", err)
+		return
+	}
+	s.text = string(data)
+}
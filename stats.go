@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// runStats tracks the API usage and timing of a discedit run, so
+// that batch operations can be tuned against the forum limits.
+type runStats struct {
+	mu     sync.Mutex
+	start  time.Time
+	phases []*phaseStats
+}
+
+type phaseStats struct {
+	name     string
+	start    time.Time
+	end      time.Time
+	requests int
+	bytes    int64
+}
+
+var stats = &runStats{start: time.Now()}
+
+// Phase marks the start of a new phase of the run, ending the
+// previous one if any.
+func (s *runStats) Phase(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if len(s.phases) > 0 {
+		s.phases[len(s.phases)-1].end = now
+	}
+	s.phases = append(s.phases, &phaseStats{name: name, start: now})
+}
+
+// Request records an API request that transferred size bytes.
+func (s *runStats) Request(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.phases) == 0 {
+		s.phases = append(s.phases, &phaseStats{name: "setup", start: s.start})
+	}
+	phase := s.phases[len(s.phases)-1]
+	phase.requests++
+	phase.bytes += size
+}
+
+// Print logs the collected statistics.
+func (s *runStats) Print() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var requests int
+	var bytes int64
+	for _, phase := range s.phases {
+		end := phase.end
+		if end.IsZero() {
+			end = now
+		}
+		log.Printf("Phase %s: %d requests, %s transferred, %s elapsed.",
+			phase.name, phase.requests, formatSize(phase.bytes), end.Sub(phase.start).Round(time.Millisecond))
+		requests += phase.requests
+		bytes += phase.bytes
+	}
+	log.Printf("Total: %d requests, %s transferred, %s elapsed.",
+		requests, formatSize(bytes), now.Sub(s.start).Round(time.Millisecond))
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fkB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PostLocalization is a translated variant of a post, as kept by
+// forums with content localization, which the translator plugin
+// relies upon to store translations.
+type PostLocalization struct {
+	Locale      string `json:"locale"`
+	Raw         string `json:"raw"`
+	PostVersion int    `json:"post_version"`
+}
+
+// Outdated reports whether the translation was made for a version of
+// the post older than the current one.
+func (l *PostLocalization) Outdated(post *Post) bool {
+	return l.PostVersion < post.Version
+}
+
+// LoadLocalizations returns the translated variants of the post,
+// sorted by locale.
+func (f *Forum) LoadLocalizations(post *Post) ([]*PostLocalization, error) {
+
+	logf("Loading translations of post %d...", post.ID)
+
+	var result struct {
+		PostLocalizations []*PostLocalization `json:"post_localizations"`
+	}
+	err := f.do("GET", "/post_localizations/"+strconv.Itoa(post.ID)+".json", nil, &result)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("forum %s does not seem to support translated posts", f.baseURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result.PostLocalizations, func(i, j int) bool {
+		return result.PostLocalizations[i].Locale < result.PostLocalizations[j].Locale
+	})
+	return result.PostLocalizations, nil
+}
+
+// SaveLocalization saves raw as the translation of the post into locale.
+func (f *Forum) SaveLocalization(post *Post, locale, raw, rawOld string) error {
+
+	logf("Saving %s translation of post %d ...", locale, post.ID)
+
+	if *dryRun {
+		logf("Dry run: not saving translation. Changes would be:")
+		showDiff(rawOld, raw)
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"post_id": post.ID,
+		"locale":  locale,
+		"raw":     raw,
+	}
+	err := f.do("POST", "/post_localizations/create_or_update.json", body, nil)
+	if err != nil {
+		return err
+	}
+
+	journal.Record("translation save", locale)
+	logf("Saved %s translation of post %d.", locale, post.ID)
+	return nil
+}
+
+func runTranslations(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("translations command expects a single topic URL")
+	}
+	forum, topicID, err := openTopic(config, args[0])
+	if err != nil {
+		return err
+	}
+	topic, err := forum.LoadTopic(topicID)
+	if err != nil {
+		return err
+	}
+	localizations, err := forum.LoadLocalizations(topic.Post)
+	if err != nil {
+		return err
+	}
+	if len(localizations) == 0 {
+		logf("Topic %s has no translations.", topic)
+		return nil
+	}
+	for _, l := range localizations {
+		status := "current"
+		if l.Outdated(topic.Post) {
+			status = "outdated"
+		}
+		fmt.Printf("%-8s %-8s %d words\n", l.Locale, status, len(strings.Fields(l.Raw)))
+	}
+	return nil
+}
+
+// runLocale edits the translation of the post into the locale given
+// with -locale. Missing translations start from the original content.
+func runLocale(forum *Forum, topic *Topic, locale string) error {
+	localizations, err := forum.LoadLocalizations(topic.Post)
+	if err != nil {
+		return err
+	}
+	initial := topic.Post.Raw
+	var existing *PostLocalization
+	for _, l := range localizations {
+		if l.Locale == locale {
+			existing = l
+			initial = l.Raw
+		}
+	}
+	if existing == nil {
+		logf("Post has no %s translation yet, so editing starts from the original content.", locale)
+	} else if existing.Outdated(topic.Post) {
+		logf("WARNING: The %s translation was made for version %d of the post, which is now at version %d.", locale, existing.PostVersion, topic.Post.Version)
+	}
+
+	filename, err := createTempFile(initial)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filename)
+
+	logf("Opening your preferred editor...")
+
+	err = runEditor(filename)
+	if err != nil {
+		return err
+	}
+	different, empty, err := fileChanged(filename, initial)
+	if err != nil {
+		return err
+	}
+	if empty {
+		return fmt.Errorf("no content provided, aborting")
+	}
+	if !different {
+		logf("No changes to save.")
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read edited content at %s: %v", filename, err)
+	}
+	rawOld := ""
+	if existing != nil {
+		rawOld = existing.Raw
+	}
+	err = forum.SaveLocalization(topic.Post, locale, string(bytes.TrimSpace(content)), rawOld)
+	if err != nil {
+		// Keep the edited translation rather than removing it.
+		renameToLast(filename)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func runUpload(config *Config, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("upload command expects a forum URL and one or more files")
+	}
+	baseURL, err := parseForumURL(config.expandAlias(args[0]))
+	if err != nil {
+		return err
+	}
+	forum, err := openForum(config, baseURL)
+	if err != nil {
+		return err
+	}
+	err = forum.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	// Check all files before uploading any of them.
+	for _, filename := range args[1:] {
+		err := forum.CheckUpload(filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, filename := range args[1:] {
+		upload, err := forum.Upload(filename)
+		if err != nil {
+			return err
+		}
+		if upload != nil {
+			fmt.Println(upload.Markdown())
+		}
+	}
+	return nil
+}
+
+// Upload is a file uploaded to a forum.
+type Upload struct {
+	ID               int    `json:"id"`
+	URL              string `json:"url"`
+	ShortURL         string `json:"short_url"`
+	OriginalFilename string `json:"original_filename"`
+	Width            int    `json:"width"`
+	Height           int    `json:"height"`
+}
+
+// Markdown returns the markdown that shows the upload in a post.
+func (u *Upload) Markdown() string {
+	if u.Width > 0 && u.Height > 0 {
+		return fmt.Sprintf("![%s|%dx%d](%s)", u.OriginalFilename, u.Width, u.Height, u.ShortURL)
+	}
+	return fmt.Sprintf("[%s|attachment](%s)", u.OriginalFilename, u.ShortURL)
+}
+
+var imageExtensions = map[string]bool{
+	"png": true, "jpg": true, "jpeg": true, "gif": true, "webp": true,
+	"avif": true, "bmp": true, "ico": true, "svg": true, "tif": true, "tiff": true,
+}
+
+// CheckUpload returns an error if the forum site settings are known to
+// reject the file due to its size or extension. If the site settings are
+// unavailable the file is assumed to be acceptable.
+func (f *Forum) CheckUpload(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("cannot upload %s: %v", filename, err)
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+
+	if value, ok := f.SiteSettings()["authorized_extensions"]; ok {
+		allowed := false
+		for _, e := range strings.Split(value, "|") {
+			e = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(e), "."))
+			if e == "*" || e == ext {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("cannot upload %s: forum only accepts files with extensions %s", filename, strings.Replace(value, "|", ", ", -1))
+		}
+	}
+
+	setting := "max_attachment_size_kb"
+	if imageExtensions[ext] {
+		setting = "max_image_size_kb"
+	}
+	if maxKB, ok := f.siteSettingInt(setting); ok && info.Size() > int64(maxKB)*1024 {
+		return fmt.Errorf("cannot upload %s: file has %s but forum accepts at most %s", filename, formatSize(info.Size()), formatSize(int64(maxKB)*1024))
+	}
+	return nil
+}
+
+// Upload uploads the file to the forum. In dry-run mode nothing is
+// uploaded and the returned upload is nil.
+func (f *Forum) Upload(filename string) (*Upload, error) {
+	err := f.CheckUpload(filename)
+	if err != nil {
+		return nil, err
+	}
+	if *dryRun {
+		logf("Dry run: not uploading %s.", filename)
+		return nil, nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot upload %s: %v", filename, err)
+	}
+	if info.Size() > multipartThreshold && f.PublicSiteSettings()["enable_direct_s3_uploads"] == "true" {
+		return f.uploadMultipart(filename, info.Size())
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %v", filename, err)
+	}
+
+	logf("Uploading %s (%s)...", filename, formatSize(int64(len(data))))
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("type", "composer")
+	w.WriteField("synchronous", "true")
+	part, err := w.CreateFormFile("file", filepath.Base(filename))
+	if err == nil {
+		_, err = part.Write(data)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("internal error: cannot prepare upload: %v", err)
+	}
+
+	const path = "/uploads.json"
+	req, err := http.NewRequest("POST", f.baseURL+path, &body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	debugf("POST on %s with %s", path, filename)
+
+	var upload Upload
+	err = f.sendTransfer(req, path, &upload)
+	if err != nil {
+		return nil, fmt.Errorf("cannot upload %s: %v", filename, err)
+	}
+	return &upload, nil
+}
+
+// Files larger than multipartThreshold are uploaded in parts of
+// multipartPartSize straight into the external storage of forums
+// that support it. Parts must be at least 5MB large for S3.
+const (
+	multipartThreshold = 100 << 20
+	multipartPartSize  = 10 << 20
+	multipartBatchSize = 10
+)
+
+type multipartPart struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+// uploadMultipart uploads the file in multiple parts into the external
+// storage of the forum, following the flow used by Discourse itself when
+// the enable_direct_s3_uploads site setting is on. Parts are presigned
+// by the forum in batches and sent directly to the storage.
+func (f *Forum) uploadMultipart(filename string, size int64) (upload *Upload, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot upload %s: %v", filename, err)
+	}
+	defer file.Close()
+
+	hash := sha1.New()
+	_, err = io.Copy(hash, file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %v", filename, err)
+	}
+
+	parts := int((size + multipartPartSize - 1) / multipartPartSize)
+	logf("Uploading %s (%s) in %d parts...", filename, formatSize(size), parts)
+
+	var created struct {
+		ExternalUploadIdentifier string `json:"external_upload_identifier"`
+		UniqueIdentifier         string `json:"unique_identifier"`
+	}
+	body := map[string]interface{}{
+		"file_name":   filepath.Base(filename),
+		"file_size":   size,
+		"upload_type": "composer",
+		"metadata":    map[string]string{"sha1-checksum": hex.EncodeToString(hash.Sum(nil))},
+	}
+	err = f.do("POST", "/uploads/create-multipart.json", body, &created)
+	if err != nil {
+		return nil, fmt.Errorf("cannot upload %s: %v", filename, err)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		body := map[string]string{"external_upload_identifier": created.ExternalUploadIdentifier}
+		if abortErr := f.do("POST", "/uploads/abort-multipart.json", body, nil); abortErr != nil {
+			logf("WARNING: Cannot abort upload of %s: %v", filename, abortErr)
+		}
+	}()
+
+	var completed []multipartPart
+	buf := make([]byte, multipartPartSize)
+	for first := 1; first <= parts; first += multipartBatchSize {
+		var numbers []int
+		for n := first; n <= parts && n < first+multipartBatchSize; n++ {
+			numbers = append(numbers, n)
+		}
+		var presigned struct {
+			PresignedURLs map[string]string `json:"presigned_urls"`
+		}
+		body := map[string]interface{}{
+			"part_numbers":      numbers,
+			"unique_identifier": created.UniqueIdentifier,
+		}
+		err = f.do("POST", "/uploads/batch-presign-multipart-parts.json", body, &presigned)
+		if err != nil {
+			return nil, fmt.Errorf("cannot upload %s: %v", filename, err)
+		}
+		for _, n := range numbers {
+			partURL := presigned.PresignedURLs[strconv.Itoa(n)]
+			if partURL == "" {
+				return nil, fmt.Errorf("cannot upload %s: forum did not presign part %d", filename, n)
+			}
+			read, err := io.ReadFull(file, buf)
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("cannot read %s: %v", filename, err)
+			}
+			etag, err := f.uploadPart(partURL, buf[:read])
+			if err != nil {
+				return nil, fmt.Errorf("cannot upload part %d of %s: %v", n, filename, err)
+			}
+			debugf("Uploaded part %d of %d with etag %s", n, parts, etag)
+			completed = append(completed, multipartPart{PartNumber: n, ETag: etag})
+		}
+	}
+
+	body = map[string]interface{}{
+		"unique_identifier": created.UniqueIdentifier,
+		"parts":             completed,
+	}
+	upload = &Upload{}
+	err = f.doTransfer("POST", "/uploads/complete-multipart.json", body, upload)
+	if err != nil {
+		return nil, fmt.Errorf("cannot upload %s: %v", filename, err)
+	}
+	return upload, nil
+}
+
+// uploadPart sends data to the presigned partURL of the external storage,
+// and returns the entity tag that identifies the part once uploaded.
+func (f *Forum) uploadPart(partURL string, data []byte) (etag string, err error) {
+	ctx, cancel := transferContext()
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "PUT", partURL, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("User-Agent", f.userAgent())
+	resp, err := transferClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	stats.Request(int64(len(data)))
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("got %d status", resp.StatusCode)
+	}
+	etag = resp.Header.Get("ETag")
+	if etag == "" {
+		return "", fmt.Errorf("storage did not return an entity tag")
+	}
+	return etag, nil
+}
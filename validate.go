@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// validatePost returns a description of each reason why the forum is
+// expected to reject text as the new content of topic.Post, based on
+// the forum site settings and site information. Limits that cannot
+// be obtained are not checked.
+func validatePost(forum *Forum, topic *Topic, text string) []string {
+	var problems []string
+
+	length := utf8.RuneCountInString(strings.TrimSpace(text))
+	minSetting := "min_post_length"
+	if topic.Post.PostNumber <= 1 {
+		minSetting = "min_first_post_length"
+	}
+	if min, ok := forum.siteSettingInt(minSetting); ok && length < min {
+		problems = append(problems, fmt.Sprintf("post has %d characters, but the forum requires at least %d", length, min))
+	}
+	if max, ok := forum.siteSettingInt("max_post_length"); ok && length > max {
+		problems = append(problems, fmt.Sprintf("post has %d characters, but the forum accepts at most %d", length, max))
+	}
+
+	titleLength := utf8.RuneCountInString(topic.Title)
+	if min, ok := forum.siteSettingInt("min_topic_title_length"); ok && titleLength < min {
+		problems = append(problems, fmt.Sprintf("topic title has %d characters, but the forum requires at least %d", titleLength, min))
+	}
+	if max, ok := forum.siteSettingInt("max_topic_title_length"); ok && titleLength > max {
+		problems = append(problems, fmt.Sprintf("topic title has %d characters, but the forum accepts at most %d", titleLength, max))
+	}
+
+	site, err := forum.Site()
+	if err != nil {
+		debugf("Cannot obtain site information: %v", err)
+	} else if c := site.Category(topic.Category); c != nil && len(topic.Tags) < c.MinimumRequiredTags {
+		problems = append(problems, fmt.Sprintf("topic has %d tags, but category %q requires at least %d", len(topic.Tags), c.Name, c.MinimumRequiredTags))
+	}
+
+	return problems
+}
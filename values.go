@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Placeholders such as {{version}} in the content being published are
+// replaced by values provided with -values and -set, so that a single
+// source may update versioned topics for each release. Placeholders
+// with no value are left alone, as they may well be part of code
+// samples using template languages.
+
+var placeholderPattern = regexp.MustCompile(`{{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*}}`)
+
+// valueFlags holds the values provided with -set name=value.
+type valueFlags map[string]string
+
+var setValues = valueFlags{}
+
+func init() {
+	flag.Var(setValues, "set", "Value for {{name}} placeholders replaced when publishing, as name=value (may be repeated)")
+}
+
+func (v valueFlags) String() string {
+	var pairs []string
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v valueFlags) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("value must be provided as name=value")
+	}
+	v[s[:i]] = s[i+1:]
+	return nil
+}
+
+// templateValues returns the values for placeholders, read from the
+// YAML file provided with -values and overridden by those set with -set.
+func templateValues() (map[string]string, error) {
+	values := make(map[string]string)
+	if *valuesPath != "" {
+		data, err := ioutil.ReadFile(*valuesPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read values: %v", err)
+		}
+		err = yaml.Unmarshal(data, &values)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode values in %s: %v", *valuesPath, err)
+		}
+	}
+	for name, value := range setValues {
+		values[name] = value
+	}
+	return values, nil
+}
+
+// expandValues replaces the placeholders in text that have a value.
+func expandValues(text string) (string, error) {
+	if *valuesPath == "" && len(setValues) == 0 {
+		return text, nil
+	}
+	values, err := templateValues()
+	if err != nil {
+		return "", err
+	}
+	missing := make(map[string]bool)
+	text = placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		if !missing[name] {
+			missing[name] = true
+			debugf("No value for placeholder %s.", placeholder)
+		}
+		return placeholder
+	})
+	return text, nil
+}
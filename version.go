@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// versionCacheAge is how long the Discourse version of a forum is cached.
+const versionCacheAge = 24 * time.Hour
+
+// Version returns the Discourse version the forum runs, as reported
+// by its about page. The version is requested at most once per run,
+// and is cached across runs.
+func (f *Forum) Version() (string, error) {
+	if f.version != "" {
+		return f.version, nil
+	}
+	key := f.baseURL + " version"
+	if cacheGet(key, versionCacheAge, &f.version) && f.version != "" {
+		return f.version, nil
+	}
+
+	logf("Checking Discourse version...")
+
+	var result struct {
+		About struct {
+			Version string `json:"version"`
+		} `json:"about"`
+	}
+	err := f.do("GET", "/about.json", nil, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.About.Version == "" {
+		return "", fmt.Errorf("forum %s does not report its Discourse version", f.baseURL)
+	}
+	f.version = result.About.Version
+	err = cacheSet(key, f.version)
+	if err != nil {
+		debugf("Cannot cache forum version: %v", err)
+	}
+	return f.version, nil
+}
+
+// RequireVersion returns an error if the forum is known to run a
+// Discourse version older than min, which the feature depends upon.
+// Pre-releases are considered to have the feature of their release.
+// If the version cannot be determined the feature is assumed present.
+func (f *Forum) RequireVersion(feature, min string) error {
+	version, err := f.Version()
+	if err != nil {
+		debugf("Cannot tell whether %s are supported: %v", feature, err)
+		return nil
+	}
+	if versionLess(version, min) {
+		return fmt.Errorf("%s require Discourse %s or later, but forum %s runs %s", feature, min, f.baseURL, version)
+	}
+	return nil
+}
+
+// versionLess reports whether version a is older than version b,
+// considering only their numeric major, minor, and patch parts.
+// Missing parts count as zero, and a part such as "0-beta1" counts
+// by its leading digits, so pre-releases equal their release.
+func versionLess(a, b string) bool {
+	na := versionNumbers(a)
+	nb := versionNumbers(b)
+	for i := range na {
+		if na[i] != nb[i] {
+			return na[i] < nb[i]
+		}
+	}
+	return false
+}
+
+func versionNumbers(version string) [3]int {
+	var numbers [3]int
+	for i, part := range strings.SplitN(strings.TrimPrefix(version, "v"), ".", 4) {
+		if i == len(numbers) {
+			break
+		}
+		digits := len(part) - len(strings.TrimLeft(part, "0123456789"))
+		n, err := strconv.Atoi(part[:digits])
+		if err != nil {
+			break
+		}
+		numbers[i] = n
+		if digits < len(part) {
+			break
+		}
+	}
+	return numbers
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestVersionLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"3.1.0", "3.1.0", false},
+		{"3.0.9", "3.1.0", true},
+		{"3.1.0", "3.0.9", false},
+		{"3.1.9", "3.1.10", true},
+		{"2.9.9", "3.0.0", true},
+		{"v3.1.0", "3.1.0", false},
+
+		// Pre-releases are not older than their release.
+		{"3.1.0.beta2", "3.1.0", false},
+		{"3.1.0", "3.1.0.beta2", false},
+		{"3.1.0.beta2", "3.1.1", true},
+		{"3.1.0.beta2", "3.0.0", false},
+		{"3.2.0-beta1", "3.2.0", false},
+		{"3.2.0beta1", "3.2.0", false},
+		{"3.2.0beta1", "3.1.9", false},
+
+		// Missing components count as zero.
+		{"3.1", "3.1.0", false},
+		{"3.1.0", "3.1", false},
+		{"3", "3.0.1", true},
+		{"3.1.0.1", "3.1.0", false},
+
+		// Non-numeric parts end the version.
+		{"3.beta.1", "3.0.1", true},
+		{"3.1.x", "3.1.0", false},
+		{"latest", "0.0.1", true},
+		{"", "3.1.0", true},
+	}
+	for _, test := range tests {
+		if less := versionLess(test.a, test.b); less != test.less {
+			t.Errorf("versionLess(%q, %q) = %v, want %v", test.a, test.b, less, test.less)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/niemeyer/discedit/shlex"
+)
+
+// runView shows the content of a topic in $PAGER, for consulting it
+// from the terminal without any risk of changing it. Nothing is written
+// locally or to the forum, so there are no temporary files or drafts.
+func runView(config *Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("view command expects a single topic URL")
+	}
+	forum, topicID, postNumber, err := openPost(config, args[0])
+	if err != nil {
+		return err
+	}
+	topic, err := forum.LoadTopicPost(topicID, postNumber)
+	if err != nil {
+		return err
+	}
+	text := topic.Post.Raw
+	if *viewCooked {
+		text = cookedText(topic.Post.Cooked)
+	}
+	return runPager(topic.Title + "\n\n" + strings.TrimSpace(text) + "\n")
+}
+
+// runPager pipes text into $PAGER, or less by default. When the
+// standard output is not a terminal, text is written to it directly.
+func runPager(text string) error {
+	if !isTerminal(os.Stdout) {
+		_, err := os.Stdout.WriteString(text)
+		return err
+	}
+	pager := strings.TrimSpace(os.Getenv("PAGER"))
+	if pager == "" {
+		pager = "less"
+	}
+	args, err := shlex.Split(pager)
+	if err != nil {
+		return fmt.Errorf("cannot parse pager command: %v", err)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("cannot run pager: %v", err)
+	}
+	return nil
+}
+
+var (
+	cookedBlockPattern = regexp.MustCompile(`(?i)</?(p|div|h[1-6]|ul|ol|pre|blockquote|table|tr|aside|details|summary)\b[^>]*>|<br\s*/?>`)
+	cookedItemPattern  = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	cookedTagPattern   = regexp.MustCompile(`<[^>]*>`)
+	blankLinesPattern  = regexp.MustCompile(`\n[ \t]*(\n[ \t]*)+`)
+)
+
+// cookedText returns the text in the cooked HTML of a post, roughly laid
+// out in paragraphs and list items, for reading in the terminal.
+func cookedText(cooked string) string {
+	text := cookedBlockPattern.ReplaceAllString(cooked, "\n\n")
+	text = cookedItemPattern.ReplaceAllString(text, "\n* ")
+	text = cookedTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = blankLinesPattern.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// fileStamp identifies a version of a file being edited, so changes can
+// be noticed without reading it all the time.
+//
+// Many editors don't write files in place, but rather write a new file
+// and rename it over the old one (e.g. vim with backupcopy=no, and most
+// GUI editors). The path then refers to a different file, and that may
+// be the only visible change when both writes fall within the timestamp
+// granularity of the filesystem. So the identity of the file is compared
+// along with its size and modification time, and the file is always
+// looked up again by its path rather than held open.
+type fileStamp struct {
+	info os.FileInfo
+}
+
+// stampFile returns the current stamp of the named file. While an editor
+// replaces a file the path may briefly not exist, which is reported as
+// an error satisfying os.IsNotExist.
+func stampFile(filename string) (fileStamp, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return fileStamp{}, fmt.Errorf("%s is not a regular file", filename)
+	}
+	return fileStamp{info}, nil
+}
+
+// Same reports whether s and other stamp the same version of a file.
+func (s fileStamp) Same(other fileStamp) bool {
+	if s.info == nil || other.info == nil {
+		return s.info == other.info
+	}
+	return os.SameFile(s.info, other.info) &&
+		s.info.Size() == other.info.Size() &&
+		s.info.ModTime().Equal(other.info.ModTime())
+}